@@ -4,7 +4,7 @@ package bilibili
 type CommonResponse struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
-	ttl     int    `json:"ttl"`
+	Ttl     int    `json:"ttl"`
 }
 
 // Reply 评论
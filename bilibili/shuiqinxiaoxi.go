@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"go-spider/common"
+	"go-spider/metrics"
 	"io"
 	"net/http"
 	"os"
+	"time"
 )
 
 func list() {
@@ -72,11 +74,14 @@ func request(method, url string, headers map[string]string) (r []byte, err error
 			req.Header.Set(k, v)
 		}
 	}
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		metrics.ObserveRequest("bilibili", req.URL.Host, 0, time.Since(start))
 		return
 	}
 	defer resp.Body.Close()
+	metrics.ObserveRequest("bilibili", req.URL.Host, resp.StatusCode, time.Since(start))
 	if resp.StatusCode != http.StatusOK {
 		return nil, errors.New("status code is not 200")
 	}
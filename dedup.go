@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go-spider/imagehash"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// dedupReport 相似图片检测的结果
+type dedupReport struct {
+	Dir        string              `json:"dir"`
+	Algorithm  imagehash.Algorithm `json:"algorithm"`
+	Threshold  int                 `json:"threshold"`
+	Images     int                 `json:"images"`
+	Duplicates int                 `json:"duplicates"` // 除每组保留的图片外的数量
+	Action     string              `json:"action"`
+	Clusters   []imagehash.Cluster `json:"clusters"`
+	Errors     []string            `json:"errors,omitempty"`
+}
+
+// dedupCommand 检测图片目录中的相似图片：go-spider dedup [-algo phash] [-threshold 6] [-action report|link|delete] [dir]
+func dedupCommand(args []string) error {
+	fset := flag.NewFlagSet("dedup", flag.ExitOnError)
+	algo := fset.String("algo", string(imagehash.PHash), "感知哈希算法:ahash、dhash或phash")
+	threshold := fset.Int("threshold", -1, "汉明距离不超过此值的图片视为相似(0-64)，默认按算法选择")
+	action := fset.String("action", "report", "对重复图片的处理:report只输出报告，link替换为保留图片的硬链接，delete删除")
+	reportFile := fset.String("report", "", "将JSON格式的报告写入此文件")
+	skip := fset.String("skip", "thumbs,contact.jpg", "跳过的文件或目录名，逗号分隔")
+	workers := fset.Int("workers", 0, "并发计算的数量，默认为CPU核数")
+	fset.Parse(args)
+	dir := "images"
+	if fset.NArg() > 0 {
+		dir = fset.Arg(0)
+	}
+
+	algorithm, err := imagehash.ParseAlgorithm(*algo)
+	if err != nil {
+		return err
+	}
+	if *threshold < 0 {
+		*threshold = imagehash.DefaultThreshold(algorithm)
+	}
+	if *threshold > 64 {
+		return fmt.Errorf("距离阈值应在0-64之间:%d", *threshold)
+	}
+	if *action != "report" && *action != "link" && *action != "delete" {
+		return fmt.Errorf("不支持的处理方式:%q", *action)
+	}
+	skipped := map[string]bool{}
+	for _, name := range strings.Split(*skip, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			skipped[name] = true
+		}
+	}
+
+	report := dedupReport{Dir: dir, Algorithm: algorithm, Threshold: *threshold, Action: *action}
+	var mu sync.Mutex
+	scanner := imagehash.Scanner{
+		Algorithm: algorithm,
+		Workers:   *workers,
+		Skip: func(path string, d fs.DirEntry) bool {
+			return skipped[d.Name()]
+		},
+		OnError: func(path string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", path, err))
+		},
+	}
+	entries, err := scanner.Scan(dir)
+	if err != nil {
+		return err
+	}
+	report.Images = len(entries)
+	report.Clusters = imagehash.Group(entries, *threshold)
+	for _, c := range report.Clusters {
+		report.Duplicates += len(c) - 1
+		for _, dup := range c[1:] {
+			if err := resolveDuplicate(*action, c[0].Path, dup.Path); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", dup.Path, err))
+			}
+		}
+	}
+
+	printDedupReport(report)
+	if *reportFile != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(*reportFile, data, 0644)
+	}
+	return nil
+}
+
+// resolveDuplicate 按处理方式处理重复的图片，keep为同组中保留的图片
+func resolveDuplicate(action, keep, dup string) error {
+	switch action {
+	case "link":
+		if same, err := sameFile(keep, dup); err != nil || same {
+			return err
+		}
+		tmp := dup + ".link"
+		if err := os.Link(keep, tmp); err != nil {
+			return err
+		}
+		return os.Rename(tmp, dup)
+	case "delete":
+		return os.Remove(dup)
+	}
+	return nil
+}
+
+// sameFile 两个路径是否已经是同一个文件
+func sameFile(a, b string) (bool, error) {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(ia, ib), nil
+}
+
+// printDedupReport 输出每组相似图片，第一张为保留的图片
+func printDedupReport(r dedupReport) {
+	fmt.Printf("扫描%s: %d张图片，%d组相似图片，%d张重复(%s，距离<=%d)\n",
+		r.Dir, r.Images, len(r.Clusters), r.Duplicates, r.Algorithm, r.Threshold)
+	for i, c := range r.Clusters {
+		fmt.Printf("#%d\n", i+1)
+		for j, e := range c {
+			mark := "  "
+			if j == 0 {
+				mark = "* "
+			}
+			rel, err := filepath.Rel(r.Dir, e.Path)
+			if err != nil {
+				rel = e.Path
+			}
+			fmt.Printf("  %s%s %dx%d %s 距离:%d\n", mark, e.Hash, e.Dim.X, e.Dim.Y, rel, imagehash.Distance(c[0].Hash, e.Hash))
+		}
+	}
+	for _, e := range r.Errors {
+		fmt.Println("错误:", e)
+	}
+}
+
+// errUsage 未知的子命令
+var errUsage = errors.New("用法: go-spider [-metrics addr] [dedup [flags] [dir]]")
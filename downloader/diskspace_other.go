@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+// +build !linux,!darwin,!freebsd,!dragonfly,!windows
+
+package downloader
+
+import "errors"
+
+// diskFree 当前系统不支持检查可用空间
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("当前系统不支持检查磁盘空间")
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime/debug"
 	"runtime/pprof"
 	"sync"
@@ -20,31 +21,85 @@ import (
 // Downloader 下载器
 type Downloader struct {
 	*http.Client
-	Tasks        []*DownloadTask
-	Success      int // 成功数量
-	Fail         int // 失败数量
-	Processing   int // 处理中数量
-	Pending      int // 等待中数量
-	Finished     int // 结束的数量
-	StartAt      time.Time
-	EndAt        time.Time
-	DownloadSize float64
-	ctx          context.Context
-	cancel       func()
-	sigs         []os.Signal // 信号
-	wg           *sync.WaitGroup
+	Tasks            []*DownloadTask
+	Success          int // 成功数量
+	Fail             int // 失败数量
+	Processing       int // 处理中数量
+	Pending          int // 等待中数量
+	Finished         int // 结束的数量
+	StartAt          time.Time
+	EndAt            time.Time
+	DownloadSize     float64
+	ctx              context.Context
+	cancel           func()
+	sigs             []os.Signal // 信号
+	wg               *sync.WaitGroup
+	mu               sync.Mutex               // 保护Tasks、names、running和closed
+	names            map[string]*DownloadTask // 添加任务时的文件名 -> 任务，同一文件只添加一次
+	running          bool
+	closed           bool // 是否已经调用Close
+	queue            *taskQueue
+	stats            *stats
+	statsStop        chan struct{}
+	statsDone        chan struct{}
+	progressInterval time.Duration   // 进度快照间隔
+	concurrency      int             // 最大并发下载数
+	retry            *RetryPolicy    // 重试策略
+	journal          *journal        // 任务日志，为nil时不记录
+	fixExtension     bool            // 是否按识别出的文件类型修正扩展名
+	validators       *validatorIndex // 文件的ETag和Last-Modified索引，为nil时不发送条件请求
+	skip             SkipPolicy      // 目标文件已存在时的跳过策略
+	store            *dedupStore     // 内容寻址存储，为nil时不去重
+	segments         int             // 分段下载的段数，<=1时不分段
+	segmentThreshold int64           // 文件大于此值时才分段下载
+	storage          Storage         // 存储后端
+	stagingDir       string          // 存储不在本地时.part文件的暂存目录
+	bandwidth        *bandwidth      // 所有任务共享的带宽限制
+	shutdown         *shutdown
+	drainTimeout     time.Duration // 停止时等待正在下载的任务的时间
+	snapshotFile     string        // 停止时写入未完成任务的文件，为空时不写入
+	failedFile       string        // 结束时写入失败任务的文件，为空时不写入
+	hooks            hooks
+	pause            *pause
+	reportFiles      []string // Result保存报告的文件
+	limits           limits   // 磁盘空间检查和单次运行的上限
+
+	hostLimits       map[string]HostLimit // 按主机配置的限速
+	defaultHostLimit HostLimit            // 未单独配置的主机使用的限速
+	hostsMu          sync.Mutex
+	hosts            map[string]*hostLimiter
 }
 
 // NewDownloader 创建下载器
-func NewDownloader() Downloader {
+func NewDownloader(opts ...Option) *Downloader {
 	ctx, cancel := context.WithCancel(context.Background())
-	return Downloader{
-		Client: &http.Client{},
-		ctx:    ctx,
-		cancel: cancel,
-		sigs:   []os.Signal{os.Interrupt, syscall.SIGINT, syscall.SIGKILL},
-		wg:     &sync.WaitGroup{},
+	d := &Downloader{
+		Client:           &http.Client{},
+		ctx:              ctx,
+		cancel:           cancel,
+		sigs:             []os.Signal{os.Interrupt, syscall.SIGTERM},
+		wg:               &sync.WaitGroup{},
+		queue:            newTaskQueue(DefaultAgingInterval),
+		stats:            newStats(),
+		progressInterval: DefaultProgressInterval,
+		storage:          LocalStorage{},
+		stagingDir:       DefaultStagingDir,
+		bandwidth:        newBandwidth(0),
+		shutdown:         newShutdown(),
+		pause:            newPause(),
+		drainTimeout:     DefaultDrainTimeout,
+		snapshotFile:     DefaultSnapshotFile,
+		reportFiles:      DefaultReportFiles,
+		concurrency:      DefaultConcurrency,
+		retry:            DefaultRetryPolicy(),
+		hostLimits:       map[string]HostLimit{},
+		hosts:            map[string]*hostLimiter{},
+		names:            map[string]*DownloadTask{},
+	}
+	for _, opt := range opts {
+		opt(d)
 	}
+	return d
 }
 
 func (d *Downloader) setupPprof(fn func()) {
@@ -60,53 +115,208 @@ func (d *Downloader) StartWitiPprof() {
 	d.setupPprof(d.Start)
 }
 
-// Start 启动
+// Start 启动并等待所有任务完成
 func (d *Downloader) Start() {
-	// file, _ := os.OpenFile("cpu.pprof", os.O_CREATE|os.O_RDWR, 0644)
-	// defer file.Close()
-	// pprof.StartCPUProfile(file)
-	// defer pprof.StopCPUProfile()
+	d.Run()
+	d.Close()
+	d.Wait()
+}
+
+// Run 启动worker后立即返回，之后仍可以通过AddTask继续添加任务，
+// 添加完毕后调用Close，再调用Wait等待所有任务完成
+func (d *Downloader) Run() {
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, d.sigs...)
+	go d.handleSignals(sig)
+	d.StartAt = time.Now()
+	d.stats.begin(d.StartAt)
+	d.statsStop, d.statsDone = make(chan struct{}), make(chan struct{})
 	go func() {
-		select {
-		case <-sig:
-			d.cancel()
-		case <-d.ctx.Done():
-			d.cancel()
-		}
+		defer close(d.statsDone)
+		d.stats.run(d.progressInterval, d.statsStop)
 	}()
-	d.StartAt = time.Now()
-	log.Printf("开始执行任务，本次共有%d个任务\n", len(d.Tasks))
+	log.Printf("开始执行任务，当前共有%d个任务，最大并发数%d\n", len(d.Tasks), d.concurrency)
 
-	for i, task := range d.Tasks {
-		d.Processing++
+	if d.journal != nil {
+		// 需要确认日志可以写入时，在Run之前调用LoadJournal或RestoreJournal
+		if err := d.journal.open(); err != nil {
+			log.Println("打开任务日志失败:", err)
+		}
+	}
+	if d.validators != nil {
+		if err := d.validators.load(); err != nil {
+			log.Println("读取校验信息索引失败:", err)
+		}
+	}
+	go func() {
+		// 取消后不再等待新任务，让worker尽快退出
+		<-d.ctx.Done()
+		d.queue.close()
+	}()
+	d.startLimits()
+	for i := 0; i < d.concurrency; i++ {
 		d.wg.Add(1)
-		go func() {
-			d.execute(task)
-		}()
-		d.Tasks[i] = task
+		go d.worker()
+	}
+
+	d.mu.Lock()
+	d.running = true
+	tasks := d.Tasks
+	d.mu.Unlock()
+	for _, task := range tasks {
+		d.enqueue(task)
 	}
+}
+
+// ErrClosed 调用Close后继续添加任务的错误
+var ErrClosed = errors.New("下载器已关闭，不能再添加任务")
+
+// Close 表示不再添加任务，worker处理完队列中剩余的任务后退出，之后AddTask返回ErrClosed
+func (d *Downloader) Close() {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	d.queue.close()
+}
+
+// Wait 等待队列中的任务全部完成，需先调用Close
+func (d *Downloader) Wait() {
 	d.wg.Wait()
-	// TODO: 任务越多，执行到后面越慢。最后一个任务一一直无法结束，一致等待。
 	d.EndAt = time.Now()
+	d.stopLimits()
+	close(d.statsStop)
+	<-d.statsDone
+	if d.journal != nil {
+		d.journal.close()
+	}
+	if d.validators != nil {
+		if err := d.validators.save(); err != nil {
+			log.Println("保存校验信息索引失败:", err)
+		}
+	}
+	if err := d.storage.Close(); err != nil {
+		log.Println("关闭存储失败:", err)
+	}
+	if err := d.writeFailed(); err != nil {
+		log.Println("写入失败任务文件失败:", err)
+	}
+	if d.shutdown.stopped() {
+		if err := d.writeSnapshot(); err != nil {
+			log.Println("写入未完成任务快照失败:", err)
+		}
+	}
+	d.hooks.fireFinish(d.stats.snapshot())
+	// 释放Run中启动的后台goroutine
+	d.cancel()
+}
+
+// enqueue 将未完成的任务放入队列，根据任务日志已经完成的任务直接触发结束回调
+func (d *Downloader) enqueue(task *DownloadTask) {
+	if task.State.completed() {
+		d.hooks.fireTaskDone(task)
+		return
+	}
+	d.record(task, StatePending)
+	if !d.queue.push(task) && !d.shutdown.stopped() && d.ctx.Err() == nil {
+		log.Printf("队列已关闭，任务%d未执行\n", task.ID)
+	}
 }
 
-// AddTask 添加任务
-func (d *Downloader) AddTask(url, file string) (err error) {
+// worker 从队列中获取任务并执行，队列关闭且为空后退出
+func (d *Downloader) worker() {
+	defer d.wg.Done()
+	for {
+		task, ok := d.queue.pop()
+		if !ok {
+			return
+		}
+		// 暂停时等待恢复，停止时由下面的检查处理
+		d.pause.wait(d.ctx, d.shutdown.stopping)
+		if d.shutdown.stopped() || d.ctx.Err() != nil {
+			// 停止后不再开始新任务，保持等待状态，下次运行时恢复
+			task.Error = ErrStopped
+			d.record(task, StatePending)
+			continue
+		}
+		if d.shouldSkip(task) {
+			d.record(task, StateSkipped)
+			d.hooks.fireTaskDone(task)
+			continue
+		}
+		if !d.reserveFile() {
+			task.Error = ErrStopped
+			d.record(task, StatePending)
+			continue
+		}
+		d.record(task, StateRunning)
+		d.hooks.fireTaskStart(task)
+		if err := d.execute(task); interrupted(err) {
+			d.releaseFile()
+			d.record(task, StatePending)
+			continue
+		} else if err != nil {
+			d.releaseFile()
+			d.record(task, StateFailed)
+		} else {
+			if task.Unchanged {
+				d.releaseFile()
+				d.stats.unchanged()
+			} else {
+				d.dedup(task)
+				d.remember(task)
+			}
+			d.record(task, StateDone)
+		}
+		d.hooks.fireTaskDone(task)
+	}
+}
+
+// AddTask 添加任务，下载器运行中时任务会直接进入队列。
+// 同一文件的任务已经添加过(如LoadJournal恢复的任务)时不再重复添加。
+// 调用Close后返回ErrClosed，开始停止后返回ErrStopped，任务不会被添加。
+func (d *Downloader) AddTask(url, file string, opts ...TaskOption) (err error) {
 	req, err := common.FormRequest(url, nil)
 	if err != nil {
 		return err
 	}
 	task := &DownloadTask{
-		ID:      len(d.Tasks) + 1,
 		Url:     url,
 		Request: req,
 		File: File{
 			Name: file,
 		},
+		State:     StatePending,
+		name:      file,
+		bandwidth: newBandwidth(0),
+	}
+	for _, opt := range opts {
+		opt(task)
 	}
+	if d.journal != nil {
+		d.journal.restore(task, d.exists)
+	}
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return ErrClosed
+	}
+	if d.shutdown.stopped() {
+		d.mu.Unlock()
+		return ErrStopped
+	}
+	if _, ok := d.names[task.requested()]; ok {
+		d.mu.Unlock()
+		return nil
+	}
+	task.ID = len(d.Tasks) + 1
 	d.Tasks = append(d.Tasks, task)
+	d.names[task.requested()] = task
+	running := d.running
+	d.mu.Unlock()
+	d.stats.add(task)
+	if running {
+		d.enqueue(task)
+	}
 	return
 }
 
@@ -117,90 +327,186 @@ func (d *Downloader) AddTask(url, file string) (err error) {
 // 	done <- task.ID
 // }
 
-// execute 执行下载任务
-func (d Downloader) execute(task *DownloadTask) error {
-	log.Printf("完成进度:%d/%d\n", d.Finished, len(d.Tasks))
+// execute 执行下载任务，失败时按重试策略重试
+func (d *Downloader) execute(task *DownloadTask) (err error) {
+	snap := d.stats.snapshot()
+	log.Printf("完成进度:%d/%d\n", snap.Finished, snap.Total)
 	task.Start = time.Now()
 	defer func() {
-		d.wg.Done()
-		d.Finished++
+		task.End = time.Now()
 		if msg := recover(); msg != nil {
 			log.Println(msg, debug.Stack())
-			task.Error = errors.New(fmt.Sprintf("%v", msg))
-			return
+			task.Error = &DownloadError{Kind: KindUnknown, Err: fmt.Errorf("%v", msg)}
+			err = task.Error
 		}
 	}()
-	task.Request.WithContext(d.ctx)
-	resp, err := d.Client.Do(task.Request)
+	for {
+		task.Attempts++
+		resp, err := d.attempt(task)
+		if err != nil && d.suspended(err) {
+			// 暂停中断了传输，不计入尝试次数，恢复后从已下载的位置继续
+			task.Attempts--
+			log.Printf("任务%d已暂停\n", task.ID)
+			if err := d.pause.wait(d.ctx, d.shutdown.stopping); err != nil {
+				task.Error = err
+				return err
+			}
+			continue
+		}
+		if err == nil {
+			task.Error = nil
+			break
+		}
+		derr := d.wrapError(resp, err)
+		task.Errors = append(task.Errors, derr)
+		task.Error = derr
+		if task.Attempts >= d.retry.MaxAttempts || !derr.Retryable {
+			return derr
+		}
+		delay := d.retry.Backoff(task.Attempts, resp)
+		retriesMetric.Inc(task.Request.URL.Host)
+		log.Printf("任务%d第%d次下载失败:%v，%s后重试\n", task.ID, task.Attempts, err, delay)
+		if sleep(d.ctx, delay) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// download 执行一次下载请求，返回的响应用于判断是否需要重试。
+// 数据先写入.part文件，服务端支持Range时从已下载的位置继续，全部完成后再重命名为目标文件。
+func (d *Downloader) download(task *DownloadTask) (*http.Response, error) {
+	part := d.partPath(task)
+	if err := os.MkdirAll(filepath.Dir(part), 0755); err != nil {
+		return nil, err
+	}
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+	var validators Validators
+	var size int64
+	conditional := false
+	if offset == 0 {
+		validators, size, conditional = d.conditional(task)
+	}
+	// 条件请求时不分段，文件未变化时只需要一次请求
+	if offset == 0 && d.segments > 1 && !conditional {
+		if resp, ok, err := d.downloadSegmented(task); ok || err != nil {
+			return resp, err
+		}
+	}
+	req := task.Request.Clone(task.ctx)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if task.validator != "" {
+			req.Header.Set("If-Range", task.validator)
+		}
+	} else if conditional {
+		setConditional(req, validators)
+	}
+	resp, err := d.Client.Do(req)
 	if err != nil {
-		task.Error = err
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 	task.Response = resp
-	file, err := os.OpenFile(task.File.Name, os.O_RDWR|os.O_CREATE, 0666)
-	if err != nil {
-		task.Error = err
-		return err
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		// 服务端文件没有变化，保留已有文件
+		task.Unchanged = true
+		task.Size = float64(size)
+		if validators.File != "" {
+			task.File.Name = validators.File
+		}
+		return resp, nil
+	}
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+		// .part文件与服务端文件不一致，丢弃后重新下载
+		if err := os.Remove(part); err != nil {
+			return resp, err
+		}
+		return d.download(task)
 	}
 	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
-		task.Error = errors.New(resp.Status)
-		return errors.New(resp.Status)
+		return resp, &StatusError{Code: resp.StatusCode, Status: resp.Status}
 	}
-	s, err := io.Copy(file, resp.Body)
-	if err != nil {
-		task.Error = errors.New(resp.Status)
-		return errors.New(resp.Status)
-	}
-	//size := resp.Header.Get("Content-Length")
-	task.Size = float64(s)
-	// d.DownloadSize += task.Size
-	task.End = time.Now()
-	// d.Processing--
-	// d.Success++
-	return nil
-}
-
-const statisticFile = "statistic.md"
-
-func (d *Downloader) Result() {
-	taskCount := len(d.Tasks)
-	timeConsumption := d.EndAt.Sub(d.StartAt)
-	for _, t := range d.Tasks {
-		if t.Error != nil {
-			d.Fail++
-		} else {
-			d.DownloadSize += t.Size
-			d.Success++
-		}
+	if err := checkContentType(task, resp); err != nil {
+		return resp, discard(part, err)
 	}
-	downloadSpeed := float64(int(d.DownloadSize)>>20) / (d.EndAt.Sub(d.StartAt).Seconds())
-	taskPerSec := float64(d.Success) / (d.EndAt.Sub(d.StartAt).Seconds())
-	log.Println("任务总数：", taskCount, "成功数量:", d.Success, " 失败数量：", d.Fail, "任务总耗时:", d.EndAt.Sub(d.StartAt),
-		"平均每秒完成任务数为:", taskPerSec, "下载速度(M/s):", downloadSpeed)
-	if _, err := os.Stat(statisticFile); os.IsNotExist(err) {
-		file, err := os.Create(statisticFile)
-		if err != nil {
-			log.Fatal(err)
-		}
-		_, err = file.WriteString(fmt.Sprintf("| 任务总数 | 成功数量 | 失败数量 | 总耗时 | 平均每秒完成任务数 | 下载速度 |\n| ------ | ------ | ------ | ------ | ------ | ------ |\n"))
-		if err != nil {
-			log.Fatal(err)
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resp.StatusCode == http.StatusPartialContent {
+		if rangeStart(resp) != offset {
+			// 返回的不是请求的范围，丢弃.part文件，重试时不带Range从头下载
+			return resp, discard(part, errors.New("Content-Range与请求不一致"))
 		}
-		file.Close()
+		flag = os.O_WRONLY | os.O_APPEND
+	} else {
+		// 服务端忽略了Range，从头开始
+		offset = 0
 	}
-	file, err := os.OpenFile(statisticFile, os.O_APPEND|os.O_WRONLY, 0666)
-	defer file.Close()
+	task.setValidator(resp)
+	file, err := os.OpenFile(part, flag, 0666)
 	if err != nil {
-		log.Fatal(err)
+		return resp, err
+	}
+	s, err := io.Copy(file, d.reader(task, resp.Body))
+	if cerr := file.Close(); err == nil {
+		err = cerr
 	}
-	_, err = file.WriteString(fmt.Sprintf("| %d | %d | %d | %s | %f | %f\n", len(d.Tasks), d.Success, d.Fail, timeConsumption, taskPerSec, downloadSpeed))
 	if err != nil {
-		log.Fatal(err)
+		// 保留原始错误，停止下载时据此区分中止和失败
+		return resp, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if err := checkLength(resp, s); err != nil {
+		return resp, err
+	}
+	if err := d.commit(task, part); err != nil {
+		return resp, err
+	}
+	task.Size = float64(offset + s)
+	return resp, nil
+}
+
+// commit 校验.part文件后交给存储后端保存
+func (d *Downloader) commit(task *DownloadTask, part string) error {
+	if err := verifyChecksum(task, part); err != nil {
+		return discard(part, err)
+	}
+	if err := d.sniff(task, part); err != nil {
+		return err
+	}
+	if err := d.storage.Commit(part, task.File.Name); err != nil {
+		return &storageError{err}
+	}
+	return nil
+}
+
+// Result 生成本次运行的报告，记录到日志并保存到报告文件
+func (d *Downloader) Result() *Report {
+	report := d.Report()
+	sum := report.Summary
+	d.Success, d.Fail, d.Pending, d.Finished = sum.Success, sum.Fail, sum.Pending, sum.Success+sum.Fail+sum.Skipped
+	d.Processing = 0
+	d.DownloadSize = sum.Size
+	log.Println("任务总数：", sum.Total, "成功数量:", sum.Success, " 失败数量：", sum.Fail, "跳过数量:", sum.Skipped, "去重数量:", sum.Deduplicated, "未变化数量:", sum.Unchanged,
+		"任务总耗时:", d.EndAt.Sub(d.StartAt), "平均每秒完成任务数为:", sum.TaskRate, "下载速度(M/s):", sum.Throughput/(1<<20),
+		"耗时P50/P90/P99(ms):", sum.LatencyP50, sum.LatencyP90, sum.LatencyP99)
+	for _, h := range report.Hosts {
+		log.Println("主机:", h.Host, "请求数:", h.Requests, "失败数:", h.Failures,
+			"下载量(M):", h.Bytes/(1<<20), "限速等待:", h.Waited)
+	}
+	if report.Limit != nil {
+		log.Println("因触发限制提前结束:", report.Limit.Kind, report.Limit.Detail)
+	}
+	for _, t := range report.Tasks {
+		if t.Error != "" {
+			log.Println("error:", t.Url, t.Error)
+		}
 	}
-	for _, task := range d.Tasks {
-		if task.Error != nil {
-			log.Println("error:", task.Error)
+	for _, file := range d.reportFiles {
+		if err := report.Save(file); err != nil {
+			log.Println("保存报告失败:", err)
 		}
 	}
+	return report
 }
@@ -0,0 +1,221 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// ErrorKind 下载错误的类别
+type ErrorKind string
+
+const (
+	KindNetwork      ErrorKind = "network"      // 连接失败、连接断开、数据不完整
+	KindTimeout      ErrorKind = "timeout"      // 请求或读取超时
+	KindHTTP         ErrorKind = "http"         // 服务端返回非2xx状态码
+	KindFilesystem   ErrorKind = "filesystem"   // 读写本地文件或存储失败
+	KindVerification ErrorKind = "verification" // 内容校验失败
+	KindCancelled    ErrorKind = "cancelled"    // 下载器停止或中止
+	KindUnknown      ErrorKind = "unknown"      // 其他错误，如下载过程中panic
+)
+
+// StatusError 服务端返回了非2xx状态码
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return e.Status
+}
+
+// storageError 存储后端保存文件失败
+type storageError struct {
+	err error
+}
+
+func (e *storageError) Error() string {
+	return "保存文件失败: " + e.err.Error()
+}
+
+func (e *storageError) Unwrap() error {
+	return e.err
+}
+
+// DownloadError 分类后的下载错误，Err为原始错误
+type DownloadError struct {
+	Kind       ErrorKind
+	StatusCode int  // Kind为KindHTTP时的状态码
+	Retryable  bool // 按重试策略是否可以重试，重试次数用完的任务之后重新运行仍可能成功
+	Err        error
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// classify 按原始错误判断错误类别
+func classify(err error) (ErrorKind, int) {
+	var statusErr *StatusError
+	var verifyErr *VerifyError
+	var netErr net.Error
+	var urlErr *url.Error
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var storeErr *storageError
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, ErrStopped):
+		return KindCancelled, 0
+	case errors.As(err, &verifyErr):
+		return KindVerification, 0
+	case errors.As(err, &statusErr):
+		return KindHTTP, statusErr.Code
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()):
+		return KindTimeout, 0
+	case errors.As(err, &urlErr) || errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF):
+		return KindNetwork, 0
+	case errors.As(err, &pathErr) || errors.As(err, &linkErr) || errors.As(err, &storeErr):
+		return KindFilesystem, 0
+	}
+	return KindUnknown, 0
+}
+
+// wrapError 分类原始错误，已经分类的错误直接返回
+func (d *Downloader) wrapError(resp *http.Response, err error) *DownloadError {
+	var derr *DownloadError
+	if errors.As(err, &derr) {
+		return derr
+	}
+	kind, code := classify(err)
+	return &DownloadError{Kind: kind, StatusCode: code, Retryable: d.retry.ShouldRetry(resp, err), Err: err}
+}
+
+// ErrorKindOf 返回错误的类别，err为nil时返回空字符串
+func ErrorKindOf(err error) ErrorKind {
+	if err == nil {
+		return ""
+	}
+	var derr *DownloadError
+	if errors.As(err, &derr) {
+		return derr.Kind
+	}
+	kind, _ := classify(err)
+	return kind
+}
+
+// FailedTask 失败任务文件中的一条记录，包含重新下载需要的任务配置
+type FailedTask struct {
+	Url          string    `json:"url"`
+	File         string    `json:"file"`
+	Error        string    `json:"error"`
+	Kind         ErrorKind `json:"kind"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	Retryable    bool      `json:"retryable"`
+	Attempts     int       `json:"attempts"`
+	Priority     int       `json:"priority,omitempty"`
+	Checksum     string    `json:"checksum,omitempty"`
+	ContentTypes []string  `json:"content_types,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// writeFailed 将失败的任务写入失败任务文件，覆盖之前的内容。
+// 没有失败的任务时删除该文件，文件总是对应最近一次运行的结果
+func (d *Downloader) writeFailed() error {
+	if d.failedFile == "" {
+		return nil
+	}
+	d.mu.Lock()
+	tasks := d.Tasks
+	d.mu.Unlock()
+	var failed []FailedTask
+	for _, task := range tasks {
+		if task.State != StateFailed {
+			continue
+		}
+		f := FailedTask{
+			Url:          task.Url,
+			File:         task.requested(),
+			Kind:         ErrorKindOf(task.Error),
+			Attempts:     task.Attempts,
+			Priority:     task.Priority,
+			Checksum:     task.Checksum,
+			ContentTypes: task.ContentTypes,
+			Time:         time.Now(),
+		}
+		var derr *DownloadError
+		if errors.As(task.Error, &derr) {
+			f.StatusCode = derr.StatusCode
+			f.Retryable = derr.Retryable
+		}
+		if task.Error != nil {
+			f.Error = task.Error.Error()
+		}
+		failed = append(failed, f)
+	}
+	if len(failed) == 0 {
+		if err := os.Remove(d.failedFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmp := d.failedFile + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(file)
+	for _, f := range failed {
+		if err := enc.Encode(f); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, d.failedFile); err != nil {
+		return err
+	}
+	log.Printf("%d个失败的任务已写入%s\n", len(failed), d.failedFile)
+	return nil
+}
+
+// LoadFailed 读取失败任务文件并添加其中的任务，retryableOnly为true时只添加可以重试的任务
+func (d *Downloader) LoadFailed(path string, retryableOnly bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var f FailedTask
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			return err
+		}
+		if retryableOnly && !f.Retryable {
+			continue
+		}
+		if err := d.AddTask(f.Url, f.File, taskOptions(f.Priority, f.Checksum, f.ContentTypes)...); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -1,5 +1,10 @@
 package downloader
 
+import (
+	"fmt"
+	"net/http"
+)
+
 // 文件
 type File struct {
 	Type string
@@ -9,4 +14,14 @@ type File struct {
 	Mime string
 }
 
+// partSuffix 未下载完成的文件后缀
+const partSuffix = ".part"
 
+// rangeStart 解析206响应中Content-Range的起始位置，无法解析时返回-1
+func rangeStart(resp *http.Response) int64 {
+	var start int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil {
+		return -1
+	}
+	return start
+}
@@ -0,0 +1,108 @@
+package downloader
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// hooks 下载生命周期回调。
+// 回调在worker goroutine中同步执行，多个任务的回调可能同时执行；回调中的panic会被恢复并记录到日志。
+type hooks struct {
+	mu        sync.RWMutex
+	taskStart []func(task *DownloadTask)
+	progress  []func(task *DownloadTask, received int64)
+	taskDone  []func(task *DownloadTask)
+	finish    []func(snap Snapshot)
+}
+
+// OnTaskStart 注册任务开始下载时的回调
+func (d *Downloader) OnTaskStart(fn func(task *DownloadTask)) {
+	d.hooks.mu.Lock()
+	defer d.hooks.mu.Unlock()
+	d.hooks.taskStart = append(d.hooks.taskStart, fn)
+}
+
+// OnProgress 注册接收到数据时的回调，received为任务本次运行累计接收的字节数
+func (d *Downloader) OnProgress(fn func(task *DownloadTask, received int64)) {
+	d.hooks.mu.Lock()
+	defer d.hooks.mu.Unlock()
+	d.hooks.progress = append(d.hooks.progress, fn)
+}
+
+// OnTaskDone 注册任务结束时的回调，包括成功、失败和跳过，通过task.State和task.Error区分。
+// 根据任务日志已经完成的任务在加入队列时触发，因停止而未完成的任务不会触发。
+func (d *Downloader) OnTaskDone(fn func(task *DownloadTask)) {
+	d.hooks.mu.Lock()
+	defer d.hooks.mu.Unlock()
+	d.hooks.taskDone = append(d.hooks.taskDone, fn)
+}
+
+// OnFinish 注册所有任务结束后的回调，在Wait返回前调用
+func (d *Downloader) OnFinish(fn func(snap Snapshot)) {
+	d.hooks.mu.Lock()
+	defer d.hooks.mu.Unlock()
+	d.hooks.finish = append(d.hooks.finish, fn)
+}
+
+func (h *hooks) fireTaskStart(task *DownloadTask) {
+	h.mu.RLock()
+	fns := h.taskStart
+	h.mu.RUnlock()
+	for _, fn := range fns {
+		safeCall(func() { fn(task) })
+	}
+}
+
+func (h *hooks) fireProgress(task *DownloadTask, received int64) {
+	h.mu.RLock()
+	fns := h.progress
+	h.mu.RUnlock()
+	for _, fn := range fns {
+		safeCall(func() { fn(task, received) })
+	}
+}
+
+func (h *hooks) fireTaskDone(task *DownloadTask) {
+	h.mu.RLock()
+	fns := h.taskDone
+	h.mu.RUnlock()
+	for _, fn := range fns {
+		safeCall(func() { fn(task) })
+	}
+}
+
+func (h *hooks) fireFinish(snap Snapshot) {
+	h.mu.RLock()
+	fns := h.finish
+	h.mu.RUnlock()
+	for _, fn := range fns {
+		safeCall(func() { fn(snap) })
+	}
+}
+
+// safeCall 执行回调并恢复其中的panic
+func safeCall(fn func()) {
+	defer func() {
+		if msg := recover(); msg != nil {
+			log.Println("回调执行失败:", msg, string(debug.Stack()))
+		}
+	}()
+	fn()
+}
+
+// progressWriter 配合io.TeeReader统计任务和下载器接收的字节数并触发进度回调
+type progressWriter struct {
+	d    *Downloader
+	task *DownloadTask
+}
+
+func (w progressWriter) Write(p []byte) (int, error) {
+	n := int64(len(p))
+	w.d.checkBytes(w.d.stats.received(n))
+	bytesMetric.Add(float64(n))
+	received := atomic.AddInt64(&w.task.Received, n)
+	w.d.hooks.fireProgress(w.task, received)
+	return len(p), nil
+}
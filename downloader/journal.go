@@ -0,0 +1,247 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TaskState 任务状态
+type TaskState string
+
+const (
+	StatePending TaskState = "pending" // 等待中
+	StateRunning TaskState = "running" // 下载中
+	StateDone    TaskState = "done"    // 已完成
+	StateFailed  TaskState = "failed"  // 失败
+	StateSkipped TaskState = "skipped" // 文件已存在，跳过
+)
+
+// completed 任务是否已经完成，无需再下载
+func (s TaskState) completed() bool {
+	return s == StateDone || s == StateSkipped
+}
+
+// JournalEntry 任务日志中的一条记录，同一个文件以最后一条记录为准
+type JournalEntry struct {
+	Url          string    `json:"url"`
+	File         string    `json:"file"`
+	State        TaskState `json:"state"`
+	Error        string    `json:"error,omitempty"`
+	Size         float64   `json:"size,omitempty"`
+	Validator    string    `json:"validator,omitempty"`
+	Saved        string    `json:"saved,omitempty"` // 修正扩展名后实际保存的文件名
+	Priority     int       `json:"priority,omitempty"`
+	Checksum     string    `json:"checksum,omitempty"`
+	ContentTypes []string  `json:"content_types,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// journal 持久化的任务日志，每行一条JSON记录，进程中断后可以据此恢复任务
+type journal struct {
+	path    string
+	mu      sync.Mutex
+	file    *os.File
+	entries map[string]JournalEntry // 文件名 -> 最后一条记录
+}
+
+func newJournal(path string) *journal {
+	return &journal{path: path, entries: map[string]JournalEntry{}}
+}
+
+// load 读取日志文件，文件不存在时不报错
+func (j *journal) load() error {
+	file, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// 中断时可能留下不完整的最后一行
+			continue
+		}
+		j.entries[e.File] = e
+	}
+	return scanner.Err()
+}
+
+// open 压缩已有记录后以追加方式打开日志文件，已经打开时不做任何事
+func (j *journal) open() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(file)
+	for _, e := range j.entries {
+		if err := enc.Encode(e); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0666)
+	return err
+}
+
+// journalEntry 按任务当前的状态生成日志记录，任务日志和未完成任务快照共用
+func journalEntry(task *DownloadTask) JournalEntry {
+	e := JournalEntry{
+		Url:          task.Url,
+		File:         task.requested(),
+		State:        task.State,
+		Size:         task.Size,
+		Validator:    task.validator,
+		Priority:     task.Priority,
+		Checksum:     task.Checksum,
+		ContentTypes: task.ContentTypes,
+		Time:         time.Now(),
+	}
+	if task.File.Name != e.File {
+		e.Saved = task.File.Name
+	}
+	if task.Error != nil {
+		e.Error = task.Error.Error()
+	}
+	return e
+}
+
+// record 追加一条任务记录
+func (j *journal) record(task *DownloadTask) error {
+	e := journalEntry(task)
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries[e.File] = e
+	if j.file == nil {
+		return nil
+	}
+	_, err = j.file.Write(append(b, '\n'))
+	return err
+}
+
+func (j *journal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// restore 根据日志恢复任务状态：已完成且文件存在的任务标记为完成，其余重新排队
+func (j *journal) restore(task *DownloadTask, exists func(*DownloadTask) bool) {
+	j.mu.Lock()
+	e, ok := j.entries[task.requested()]
+	j.mu.Unlock()
+	if !ok {
+		return
+	}
+	task.validator = e.Validator
+	if !e.State.completed() {
+		return
+	}
+	if e.Saved != "" {
+		task.File.Name = e.Saved
+	}
+	if exists(task) {
+		task.State = e.State
+		task.Size = e.Size
+	} else {
+		task.File.Name = task.requested()
+	}
+}
+
+// RestoreJournal 读取并打开任务日志，已添加和之后添加的任务按日志恢复状态，已完成的任务在Start时跳过。
+// 与LoadJournal不同，日志中其余未完成的任务不会重新加入队列，适合之后会重新添加全部任务的场景。
+// 日志无法写入时返回错误，否则这次运行的进度不会被记录。
+func (d *Downloader) RestoreJournal() error {
+	if d.journal == nil {
+		return nil
+	}
+	if err := d.journal.load(); err != nil {
+		return err
+	}
+	if err := d.journal.open(); err != nil {
+		return fmt.Errorf("打开任务日志失败: %w", err)
+	}
+	d.mu.Lock()
+	tasks := d.Tasks
+	d.mu.Unlock()
+	for _, task := range tasks {
+		from := task.State
+		d.journal.restore(task, d.exists)
+		d.stats.transition(task, from, task.State)
+	}
+	return nil
+}
+
+// LoadJournal 读取并打开任务日志：日志中未完成的任务按记录的优先级和校验配置重新加入队列，已完成的任务在Start时跳过
+func (d *Downloader) LoadJournal() error {
+	if d.journal == nil {
+		return nil
+	}
+	if err := d.RestoreJournal(); err != nil {
+		return err
+	}
+	var pending []JournalEntry
+	d.journal.mu.Lock()
+	for _, e := range d.journal.entries {
+		if !e.State.completed() {
+			pending = append(pending, e)
+		}
+	}
+	d.journal.mu.Unlock()
+	sort.Slice(pending, func(i, k int) bool { return pending[i].Time.Before(pending[k].Time) })
+	for _, e := range pending {
+		// 已经添加过的任务不会重复添加
+		if err := d.AddTask(e.Url, e.File, taskOptions(e.Priority, e.Checksum, e.ContentTypes)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record 任务状态变化时写入日志
+func (d *Downloader) record(task *DownloadTask, state TaskState) {
+	d.stats.transition(task, task.State, state)
+	observeState(task.State, state)
+	task.State = state
+	if d.journal == nil {
+		return
+	}
+	if err := d.journal.record(task); err != nil {
+		log.Println("写入任务日志失败:", err)
+	}
+}
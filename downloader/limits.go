@@ -0,0 +1,244 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDiskCheckInterval 默认的磁盘空间检查间隔
+const DefaultDiskCheckInterval = 5 * time.Second
+
+// DiskAction 可用空间不足时的处理方式
+type DiskAction int
+
+const (
+	DiskPause DiskAction = iota // 暂停并中断正在进行的传输，空间恢复后自动继续
+	DiskStop                    // 立即停止，未完成的任务写入快照文件
+)
+
+// DiskGuard 磁盘空间检查配置
+type DiskGuard struct {
+	Path     string        // 检查的路径，为空时使用存储或暂存目录
+	MinFree  uint64        // 可用空间低于此值(字节)时触发
+	Action   DiskAction    // 触发后的处理方式
+	Interval time.Duration // 运行期间的检查间隔，<=0时为DefaultDiskCheckInterval
+}
+
+// Quota 单次运行的上限，零值表示不限制
+type Quota struct {
+	MaxBytes    int64         // 最多接收的字节数，达到后立即停止
+	MaxFiles    int           // 最多下载的文件数，达到后不再开始新任务
+	MaxDuration time.Duration // 最长运行时间，达到后停止
+}
+
+// LimitKind 触发的限制
+type LimitKind string
+
+const (
+	LimitDiskSpace LimitKind = "disk_space"
+	LimitBytes     LimitKind = "max_bytes"
+	LimitFiles     LimitKind = "max_files"
+	LimitDuration  LimitKind = "max_duration"
+)
+
+// LimitHit 运行期间触发的限制
+type LimitHit struct {
+	Kind   LimitKind `json:"kind"`
+	Detail string    `json:"detail"`
+	Time   time.Time `json:"time"`
+}
+
+// limits 磁盘空间检查和配额的运行状态
+type limits struct {
+	guard   *DiskGuard
+	quota   Quota
+	started int64 // 已开始下载且未失败的文件数，原子操作
+
+	mu          sync.Mutex
+	hit         *LimitHit // 第一次触发的限制
+	guardPaused bool      // 是否因空间不足而暂停
+	timer       *time.Timer
+	done        chan struct{}
+}
+
+// freeSpace 返回path所在文件系统的可用空间，测试中可以替换
+var freeSpace = diskFree
+
+// Limit 返回运行期间第一次触发的限制，没有触发时为nil
+func (d *Downloader) Limit() *LimitHit {
+	d.limits.mu.Lock()
+	defer d.limits.mu.Unlock()
+	if d.limits.hit == nil {
+		return nil
+	}
+	hit := *d.limits.hit
+	return &hit
+}
+
+// hitLimit 记录触发的限制，同一次运行只记录第一次
+func (d *Downloader) hitLimit(kind LimitKind, detail string) {
+	d.limits.mu.Lock()
+	first := d.limits.hit == nil
+	if first {
+		d.limits.hit = &LimitHit{Kind: kind, Detail: detail, Time: time.Now()}
+	}
+	d.limits.mu.Unlock()
+	if first {
+		log.Println("触发限制:", kind, detail)
+	}
+}
+
+// abort 立即停止，正在进行的传输被中断，已下载的部分保留在.part文件中
+func (d *Downloader) abort() {
+	d.stopGracefully()
+	d.cancel()
+}
+
+// startLimits 在Run开始时检查磁盘空间，并启动运行期间的检查
+func (d *Downloader) startLimits() {
+	d.limits.done = make(chan struct{})
+	if max := d.limits.quota.MaxDuration; max > 0 {
+		d.limits.timer = time.AfterFunc(max, func() {
+			d.hitLimit(LimitDuration, fmt.Sprintf("运行时间达到%s", max))
+			d.stopGracefully()
+		})
+	}
+	if d.limits.guard == nil {
+		return
+	}
+	d.checkDisk()
+	interval := d.limits.guard.Interval
+	if interval <= 0 {
+		interval = DefaultDiskCheckInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.checkDisk()
+			case <-d.limits.done:
+				return
+			case <-d.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stopLimits 结束运行期间的检查
+func (d *Downloader) stopLimits() {
+	if d.limits.timer != nil {
+		d.limits.timer.Stop()
+	}
+	if d.limits.done != nil {
+		close(d.limits.done)
+	}
+}
+
+// diskPath 需要检查可用空间的路径
+func (d *Downloader) diskPath() string {
+	if p := d.limits.guard.Path; p != "" {
+		return p
+	}
+	if s, ok := d.storage.(LocalStorage); ok && s.Root != "" {
+		return s.Root
+	}
+	if _, ok := d.storage.(localPather); ok {
+		return "."
+	}
+	return d.stagingDir
+}
+
+// checkDisk 检查可用空间，不足时按配置暂停或停止，因空间不足暂停后空间恢复时自动继续
+func (d *Downloader) checkDisk() {
+	g := d.limits.guard
+	path := d.diskPath()
+	free, err := freeSpace(existingDir(path))
+	if err != nil {
+		log.Println("检查磁盘空间失败:", err)
+		return
+	}
+	d.limits.mu.Lock()
+	guardPaused := d.limits.guardPaused
+	if free >= g.MinFree {
+		d.limits.guardPaused = false
+	}
+	d.limits.mu.Unlock()
+	if free >= g.MinFree {
+		if guardPaused {
+			log.Printf("%s可用空间恢复到%s\n", path, formatBytes(float64(free)))
+			d.Resume()
+		}
+		return
+	}
+	detail := fmt.Sprintf("%s可用空间%s，低于%s", path, formatBytes(float64(free)), formatBytes(float64(g.MinFree)))
+	d.hitLimit(LimitDiskSpace, detail)
+	if g.Action == DiskStop {
+		d.abort()
+		return
+	}
+	if d.Paused() {
+		return
+	}
+	log.Println(detail)
+	d.limits.mu.Lock()
+	d.limits.guardPaused = true
+	d.limits.mu.Unlock()
+	// 空间不足时正在写入的数据也会失败，无论WithSuspendOnPause如何设置都中断正在进行的传输
+	d.pauseWith(true)
+}
+
+// existingDir 返回path或其最近的已存在的上级目录，目标目录可能还没有创建
+func existingDir(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// reserveFile 开始下载一个文件前检查文件数上限
+func (d *Downloader) reserveFile() bool {
+	max := d.limits.quota.MaxFiles
+	if max <= 0 {
+		return true
+	}
+	for {
+		n := atomic.LoadInt64(&d.limits.started)
+		if n >= int64(max) {
+			d.hitLimit(LimitFiles, fmt.Sprintf("下载文件数达到%d", max))
+			d.stopGracefully()
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&d.limits.started, n, n+1) {
+			return true
+		}
+	}
+}
+
+// releaseFile 下载失败或中断的文件不计入文件数
+func (d *Downloader) releaseFile() {
+	if d.limits.quota.MaxFiles > 0 {
+		atomic.AddInt64(&d.limits.started, -1)
+	}
+}
+
+// checkBytes 接收的字节数达到上限时立即停止
+func (d *Downloader) checkBytes(total int64) {
+	if max := d.limits.quota.MaxBytes; max > 0 && total >= max && d.ctx.Err() == nil {
+		d.hitLimit(LimitBytes, fmt.Sprintf("接收字节数达到%s", formatBytes(float64(max))))
+		d.abort()
+	}
+}
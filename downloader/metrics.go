@@ -0,0 +1,25 @@
+package downloader
+
+import "go-spider/metrics"
+
+// 下载器的Prometheus指标，所有Downloader共享
+var (
+	tasksMetric   = metrics.NewCounterVec("downloader_tasks_total", "结束的任务数，按状态区分", "state")
+	runningMetric = metrics.NewGaugeVec("downloader_tasks_running", "正在下载的任务数")
+	queueMetric   = metrics.NewGaugeVec("downloader_queue_depth", "队列中等待的任务数")
+	bytesMetric   = metrics.NewCounterVec("downloader_bytes_total", "接收的字节数")
+	retriesMetric = metrics.NewCounterVec("downloader_retries_total", "重试次数，按主机区分", "host")
+)
+
+// observeState 根据任务状态的变化更新指标
+func observeState(from, to TaskState) {
+	if from == StateRunning {
+		runningMetric.Add(-1)
+	}
+	if to == StateRunning {
+		runningMetric.Add(1)
+	}
+	if to.completed() || to == StateFailed {
+		tasksMetric.Inc(string(to))
+	}
+}
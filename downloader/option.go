@@ -0,0 +1,198 @@
+package downloader
+
+import "time"
+
+const (
+	DefaultConcurrency = 16          // 默认的最大并发下载数
+	DefaultStagingDir  = ".download" // 默认的.part文件暂存目录
+)
+
+// Option 下载器配置项
+type Option func(d *Downloader)
+
+// WithConcurrency 设置同时执行的最大下载任务数，小于1时使用默认值
+func WithConcurrency(n int) Option {
+	return func(d *Downloader) {
+		if n < 1 {
+			n = DefaultConcurrency
+		}
+		d.concurrency = n
+	}
+}
+
+// WithRetryPolicy 设置失败重试策略，为nil时不重试
+func WithRetryPolicy(p *RetryPolicy) Option {
+	return func(d *Downloader) {
+		if p == nil {
+			p = &RetryPolicy{MaxAttempts: 1}
+		}
+		d.retry = p
+	}
+}
+
+// WithJournal 将任务状态记录到path指定的日志文件，配合LoadJournal可以在中断后继续下载
+func WithJournal(path string) Option {
+	return func(d *Downloader) {
+		d.journal = newJournal(path)
+	}
+}
+
+// WithValidatorIndex 将下载文件的ETag和Last-Modified记录到path指定的索引文件。
+// 之后再次下载已有的文件时发送If-None-Match/If-Modified-Since，服务端返回304时视为未变化，不重新下载。
+func WithValidatorIndex(path string) Option {
+	return func(d *Downloader) {
+		d.validators = newValidatorIndex(path)
+	}
+}
+
+// WithFixExtension 设置是否修正扩展名：下载完成后按响应头和文件内容识别类型，
+// 扩展名与实际类型不一致时以正确的扩展名保存，如把PNG图片1.jpg保存为1.png
+func WithFixExtension(fix bool) Option {
+	return func(d *Downloader) {
+		d.fixExtension = fix
+	}
+}
+
+// WithHostLimit 设置指定主机(host:port形式与URL中一致)的限速
+func WithHostLimit(host string, limit HostLimit) Option {
+	return func(d *Downloader) {
+		d.hostLimits[host] = limit
+	}
+}
+
+// WithDefaultHostLimit 设置未单独配置的主机的限速
+func WithDefaultHostLimit(limit HostLimit) Option {
+	return func(d *Downloader) {
+		d.defaultHostLimit = limit
+	}
+}
+
+// WithProgressInterval 设置进度快照的发送间隔
+func WithProgressInterval(interval time.Duration) Option {
+	return func(d *Downloader) {
+		if interval <= 0 {
+			interval = DefaultProgressInterval
+		}
+		d.progressInterval = interval
+	}
+}
+
+// WithSkipPolicy 设置目标文件已存在时的跳过策略
+func WithSkipPolicy(policy SkipPolicy) Option {
+	return func(d *Downloader) {
+		d.skip = policy
+	}
+}
+
+// WithDedupStore 将下载的文件登记到dir中的内容寻址存储，内容相同的文件以硬链接保存。
+// dir需要与下载目录位于同一文件系统。
+func WithDedupStore(dir string) Option {
+	return func(d *Downloader) {
+		d.store = &dedupStore{dir: dir}
+	}
+}
+
+// WithSegments 文件大于threshold字节且服务端支持Range时，分成n段并发下载
+func WithSegments(n int, threshold int64) Option {
+	return func(d *Downloader) {
+		d.segments = n
+		d.segmentThreshold = threshold
+	}
+}
+
+// WithStorage 设置存储后端，默认保存到本地文件系统
+func WithStorage(s Storage) Option {
+	return func(d *Downloader) {
+		d.storage = s
+	}
+}
+
+// WithStagingDir 设置存储不在本地时.part文件的暂存目录
+func WithStagingDir(dir string) Option {
+	return func(d *Downloader) {
+		d.stagingDir = dir
+	}
+}
+
+// WithBandwidthLimit 设置所有任务共享的带宽上限(字节/秒)，运行中可通过SetBandwidthLimit调整
+func WithBandwidthLimit(bytesPerSec float64) Option {
+	return func(d *Downloader) {
+		d.bandwidth.setRate(bytesPerSec)
+	}
+}
+
+// WithSuspendOnPause 设置暂停时是否中断正在进行的传输，中断的任务恢复后通过Range继续下载
+func WithSuspendOnPause(suspend bool) Option {
+	return func(d *Downloader) {
+		d.pause.suspend = suspend
+	}
+}
+
+// WithDrainTimeout 设置停止时等待正在下载的任务完成的最长时间
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(d *Downloader) {
+		d.drainTimeout = timeout
+	}
+}
+
+// WithFailedFile 设置结束时写入失败任务的文件，默认不写入，之后可以通过LoadFailed只重新下载这些任务。
+// 每次运行结束时覆盖该文件，没有失败的任务时删除该文件。
+func WithFailedFile(path string) Option {
+	return func(d *Downloader) {
+		d.failedFile = path
+	}
+}
+
+// WithSnapshotFile 设置停止时写入未完成任务的文件，为空时不写入
+func WithSnapshotFile(path string) Option {
+	return func(d *Downloader) {
+		d.snapshotFile = path
+	}
+}
+
+// WithAgingInterval 设置任务老化间隔：任务每等待interval，有效优先级提高1；<=0时只按优先级调度
+func WithAgingInterval(interval time.Duration) Option {
+	return func(d *Downloader) {
+		d.queue.aging = interval
+	}
+}
+
+// WithPriority 设置任务的优先级，越大越先下载
+func WithPriority(priority int) TaskOption {
+	return func(task *DownloadTask) {
+		task.Priority = priority
+	}
+}
+
+// WithReportFiles 设置Result保存报告的文件，格式由扩展名决定(.json、.csv、.md)，不传时不保存
+func WithReportFiles(files ...string) Option {
+	return func(d *Downloader) {
+		d.reportFiles = files
+	}
+}
+
+// WithDiskGuard 设置运行前和运行期间检查目标文件系统的可用空间，低于guard.MinFree时暂停或停止
+func WithDiskGuard(guard DiskGuard) Option {
+	return func(d *Downloader) {
+		d.limits.guard = &guard
+	}
+}
+
+// WithQuota 设置单次运行的字节数、文件数和运行时间上限，触发的限制记录在报告中
+func WithQuota(quota Quota) Option {
+	return func(d *Downloader) {
+		d.limits.quota = quota
+	}
+}
+
+// taskOptions 按任务日志或失败任务文件中记录的配置生成任务选项
+func taskOptions(priority int, checksum string, contentTypes []string) []TaskOption {
+	opts := []TaskOption{WithPriority(priority)}
+	if checksum != "" {
+		opts = append(opts, WithChecksum(checksum))
+	}
+	if len(contentTypes) > 0 {
+		opts = append(opts, WithContentTypes(contentTypes...))
+	}
+	return opts
+}
@@ -0,0 +1,119 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// pause 暂停状态，以及正在进行的传输，暂停时可以中断它们
+type pause struct {
+	mu        sync.Mutex
+	resumed   chan struct{} // 暂停时创建，恢复时关闭；为nil表示没有暂停
+	suspend   bool          // 暂停时是否中断正在进行的传输
+	interrupt bool          // 本次暂停是否中断了正在进行的传输
+	seq       int
+	transfers map[int]context.CancelFunc
+}
+
+func newPause() *pause {
+	return &pause{transfers: map[int]context.CancelFunc{}}
+}
+
+// paused 是否处于暂停状态
+func (p *pause) paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed != nil
+}
+
+// track 为一次传输创建context，暂停并中断传输时会被取消。
+// 已经处于暂停状态时返回已取消的context。
+func (p *pause) track(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed != nil && p.interrupt {
+		cancel()
+		return ctx, cancel
+	}
+	p.seq++
+	id := p.seq
+	p.transfers[id] = cancel
+	return ctx, func() {
+		p.mu.Lock()
+		delete(p.transfers, id)
+		p.mu.Unlock()
+		cancel()
+	}
+}
+
+// wait 暂停时等待恢复，停止或ctx取消时返回错误
+func (p *pause) wait(ctx context.Context, stopping <-chan struct{}) error {
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-stopping:
+		return ErrStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause 暂停下载：worker不再开始新的任务。
+// 通过WithSuspendOnPause开启后，正在进行的传输也会被中断，恢复后通过Range从已下载的位置继续。
+func (d *Downloader) Pause() {
+	d.pauseWith(d.pause.suspend)
+}
+
+// pauseWith 暂停下载，interrupt为true时中断正在进行的传输
+func (d *Downloader) pauseWith(interrupt bool) {
+	d.pause.mu.Lock()
+	if d.pause.resumed != nil {
+		d.pause.mu.Unlock()
+		return
+	}
+	d.pause.resumed = make(chan struct{})
+	d.pause.interrupt = interrupt
+	if interrupt {
+		for _, cancel := range d.pause.transfers {
+			cancel()
+		}
+	}
+	d.pause.mu.Unlock()
+	log.Println("暂停下载")
+	d.stats.setPaused(true)
+	d.stats.publish()
+}
+
+// Resume 恢复暂停的下载
+func (d *Downloader) Resume() {
+	d.pause.mu.Lock()
+	if d.pause.resumed == nil {
+		d.pause.mu.Unlock()
+		return
+	}
+	close(d.pause.resumed)
+	d.pause.resumed = nil
+	d.pause.mu.Unlock()
+	log.Println("恢复下载")
+	d.stats.setPaused(false)
+	d.stats.publish()
+}
+
+// Paused 是否处于暂停状态
+func (d *Downloader) Paused() bool {
+	return d.pause.paused()
+}
+
+// suspended 错误是否由暂停中断传输引起
+func (d *Downloader) suspended(err error) bool {
+	return errors.Is(err, context.Canceled) && d.ctx.Err() == nil
+}
@@ -0,0 +1,131 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	progressBarWidth   = 30               // 进度条宽度
+	errorWindow        = 10 * time.Second // 滚动错误数的统计窗口
+	plainPrintInterval = 5 * time.Second  // 非终端输出时的打印间隔
+)
+
+// ProgressBar 终端进度条，显示总进度、下载速度、剩余时间、活动任务数和最近的错误数。
+// 输出不是终端时退化为定期打印一行文本。
+type ProgressBar struct {
+	out       io.Writer
+	tty       bool
+	failures  []failureMark // errorWindow内的失败数变化
+	lastPrint time.Time
+}
+
+type failureMark struct {
+	time time.Time
+	fail int
+}
+
+// NewProgressBar 创建输出到out的进度条
+func NewProgressBar(out *os.File) *ProgressBar {
+	return &ProgressBar{out: out, tty: isTerminal(out)}
+}
+
+// isTerminal 判断文件是否为终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Attach 订阅下载器的进度并在后台渲染，需在Run之前调用。
+// 返回的通道在下载结束、最后一次渲染完成后关闭。
+func (p *ProgressBar) Attach(d *Downloader) <-chan struct{} {
+	snapshots := d.Subscribe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var last Snapshot
+		for snap := range snapshots {
+			last = snap
+			p.render(snap, false)
+		}
+		p.render(last, true)
+	}()
+	return done
+}
+
+// render 渲染一个快照，final为true时总是输出并换行
+func (p *ProgressBar) render(snap Snapshot, final bool) {
+	recent := p.recentFailures(snap)
+	if p.tty {
+		fmt.Fprintf(p.out, "\r%s", p.line(snap, recent))
+		if final {
+			fmt.Fprintln(p.out)
+		}
+		return
+	}
+	if final || snap.Time.Sub(p.lastPrint) >= plainPrintInterval {
+		p.lastPrint = snap.Time
+		fmt.Fprintln(p.out, p.line(snap, recent))
+	}
+}
+
+// line 生成一行进度文本
+func (p *ProgressBar) line(snap Snapshot, recent int) string {
+	percent := 0.0
+	if snap.Total > 0 {
+		percent = float64(snap.Finished) / float64(snap.Total)
+	}
+	var b strings.Builder
+	if p.tty {
+		filled := int(percent * progressBarWidth)
+		b.WriteString("[")
+		b.WriteString(strings.Repeat("=", filled))
+		if filled < progressBarWidth {
+			b.WriteString(">")
+			b.WriteString(strings.Repeat(" ", progressBarWidth-filled-1))
+		}
+		b.WriteString("] ")
+	}
+	eta := "--"
+	if snap.ETA > 0 {
+		eta = snap.ETA.Round(time.Second).String()
+	}
+	fmt.Fprintf(&b, "%5.1f%% %d/%d %s/s 剩余:%s 下载中:%d 失败:%d(最近%d)",
+		percent*100, snap.Finished, snap.Total, formatBytes(snap.Rate), eta, snap.Processing, snap.Fail, recent)
+	if snap.Paused {
+		b.WriteString(" 已暂停")
+	}
+	if p.tty {
+		// 覆盖上一次较长输出的残留字符
+		b.WriteString("   ")
+	}
+	return b.String()
+}
+
+// recentFailures 计算errorWindow内新增的失败数
+func (p *ProgressBar) recentFailures(snap Snapshot) int {
+	p.failures = append(p.failures, failureMark{snap.Time, snap.Fail})
+	i := 0
+	for i < len(p.failures)-1 && snap.Time.Sub(p.failures[i].time) > errorWindow {
+		i++
+	}
+	p.failures = p.failures[i:]
+	return snap.Fail - p.failures[0].fail
+}
+
+// formatBytes 将字节数格式化为易读的形式
+func formatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", n, units[i])
+}
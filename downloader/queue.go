@@ -0,0 +1,106 @@
+package downloader
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// DefaultAgingInterval 默认的老化间隔：任务每等待这么长时间，相当于优先级提高1
+const DefaultAgingInterval = 10 * time.Second
+
+// taskQueue 无界的优先级任务队列，生产者添加任务时不会被正在下载的worker阻塞。
+// 优先级高的任务先出队，等待时间越长的任务有效优先级越高，避免低优先级任务一直得不到执行。
+type taskQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  queueItems
+	seq    int64
+	aging  time.Duration
+	closed bool
+}
+
+// queueItem 队列中的任务。
+// 有效优先级为 Priority + 等待时间/aging，两个任务比较时当前时间会被抵消，
+// 所以可以用入队时间减去 Priority*aging 作为固定的排序依据，不需要随时间重新排序。
+type queueItem struct {
+	task  *DownloadTask
+	score int64 // 越小越先出队
+	seq   int64 // 入队顺序，score相同时先入队的先出队
+}
+
+type queueItems []queueItem
+
+func (q queueItems) Len() int { return len(q) }
+func (q queueItems) Less(i, j int) bool {
+	if q[i].score != q[j].score {
+		return q[i].score < q[j].score
+	}
+	return q[i].seq < q[j].seq
+}
+func (q queueItems) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *queueItems) Push(x interface{}) { *q = append(*q, x.(queueItem)) }
+func (q *queueItems) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	old[len(old)-1] = queueItem{}
+	*q = old[:len(old)-1]
+	return item
+}
+
+func newTaskQueue(aging time.Duration) *taskQueue {
+	q := &taskQueue{aging: aging}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// score 计算任务的排序依据，aging<=0时只按优先级排序
+func (q *taskQueue) score(task *DownloadTask, now time.Time) int64 {
+	if q.aging <= 0 {
+		return -int64(task.Priority)
+	}
+	return now.UnixNano() - int64(task.Priority)*int64(q.aging)
+}
+
+// push 添加任务，队列已关闭时返回false
+func (q *taskQueue) push(task *DownloadTask) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	q.seq++
+	heap.Push(&q.items, queueItem{task: task, score: q.score(task, time.Now()), seq: q.seq})
+	queueMetric.Add(1)
+	q.cond.Signal()
+	return true
+}
+
+// pop 取出有效优先级最高的任务，队列为空时等待，队列关闭且为空时返回false
+func (q *taskQueue) pop() (*DownloadTask, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return nil, false
+	}
+	queueMetric.Add(-1)
+	return heap.Pop(&q.items).(queueItem).task, true
+}
+
+// close 关闭队列，不再接受新任务，已有任务仍可取出
+func (q *taskQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// len 队列中等待的任务数
+func (q *taskQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
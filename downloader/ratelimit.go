@@ -0,0 +1,203 @@
+package downloader
+
+import (
+	"context"
+	"go-spider/metrics"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HostLimit 单个主机的访问限制，零值表示不限制
+type HostLimit struct {
+	Rate     float64       // 每秒请求数(令牌桶速率)，<=0不限制
+	Burst    int           // 令牌桶容量，<1时为1
+	MaxConns int           // 最大并发连接数，<=0不限制
+	Delay    time.Duration // 每次请求前随机等待[0, Delay)的时间
+}
+
+// HostStat 单个主机的请求统计
+type HostStat struct {
+	Host     string
+	Requests int           // 请求次数
+	Failures int           // 失败次数
+	Bytes    float64       // 成功下载的字节数
+	Waited   time.Duration // 因限速累计等待的时间
+}
+
+// hostLimiter 单个主机的令牌桶和连接数限制
+type hostLimiter struct {
+	limit  HostLimit
+	conns  chan struct{}
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	stat   HostStat
+}
+
+func newHostLimiter(host string, limit HostLimit) *hostLimiter {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	l := &hostLimiter{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+		stat:   HostStat{Host: host},
+	}
+	if limit.MaxConns > 0 {
+		l.conns = make(chan struct{}, limit.MaxConns)
+	}
+	return l
+}
+
+// acquire 等待连接数、随机延迟和令牌，成功后需调用release
+func (l *hostLimiter) acquire(ctx context.Context) error {
+	start := time.Now()
+	defer func() {
+		l.mu.Lock()
+		l.stat.Waited += time.Since(start)
+		l.mu.Unlock()
+	}()
+	if l.conns != nil {
+		select {
+		case l.conns <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := l.wait(ctx); err != nil {
+		l.releaseConn()
+		return err
+	}
+	return nil
+}
+
+// wait 随机延迟后从令牌桶中取出一个令牌
+func (l *hostLimiter) wait(ctx context.Context) error {
+	if l.limit.Delay > 0 {
+		if err := sleep(ctx, time.Duration(rand.Int63n(int64(l.limit.Delay)))); err != nil {
+			return err
+		}
+	}
+	if l.limit.Rate <= 0 {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.limit.Rate
+		if l.tokens > float64(l.limit.Burst) {
+			l.tokens = float64(l.limit.Burst)
+		}
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		need := time.Duration((1 - l.tokens) / l.limit.Rate * float64(time.Second))
+		l.mu.Unlock()
+		if err := sleep(ctx, need); err != nil {
+			return err
+		}
+	}
+}
+
+// release 归还连接并记录本次请求的结果
+func (l *hostLimiter) release(bytes float64, err error) {
+	l.releaseConn()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stat.Requests++
+	if err != nil {
+		l.stat.Failures++
+	} else {
+		l.stat.Bytes += bytes
+	}
+}
+
+// tryConn 有空闲连接时占用一个并返回true，不等待，成功后需调用releaseConn
+func (l *hostLimiter) tryConn() bool {
+	if l.conns == nil {
+		return true
+	}
+	select {
+	case l.conns <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *hostLimiter) releaseConn() {
+	if l.conns != nil {
+		<-l.conns
+	}
+}
+
+// limiter 获取主机对应的限速器，不存在时按配置创建
+func (d *Downloader) limiter(host string) *hostLimiter {
+	d.hostsMu.Lock()
+	defer d.hostsMu.Unlock()
+	if l, ok := d.hosts[host]; ok {
+		return l
+	}
+	limit, ok := d.hostLimits[host]
+	if !ok {
+		limit = d.defaultHostLimit
+	}
+	l := newHostLimiter(host, limit)
+	d.hosts[host] = l
+	return l
+}
+
+// attempt 按主机限速后执行一次下载
+func (d *Downloader) attempt(task *DownloadTask) (*http.Response, error) {
+	ctx, done := d.pause.track(d.ctx)
+	defer done()
+	task.ctx = ctx
+	l := d.limiter(task.Request.URL.Host)
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := d.download(task)
+	l.release(task.Size, err)
+	code := 0
+	if resp != nil {
+		code = resp.StatusCode
+	}
+	metrics.ObserveRequest("downloader", task.Request.URL.Host, code, time.Since(start))
+	return resp, err
+}
+
+// HostStats 各主机的请求统计，按主机名排序
+func (d *Downloader) HostStats() (stats []HostStat) {
+	d.hostsMu.Lock()
+	defer d.hostsMu.Unlock()
+	for _, l := range d.hosts {
+		l.mu.Lock()
+		stats = append(stats, l.stat)
+		l.mu.Unlock()
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Host < stats[j].Host })
+	return
+}
+
+// sleep 等待指定时间，ctx取消时提前返回
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
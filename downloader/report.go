@@ -0,0 +1,228 @@
+package downloader
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultReportFiles 默认的报告文件，沿用原来追加到statistic.md的统计表
+var DefaultReportFiles = []string{"statistic.md"}
+
+// Report 一次运行的报告
+type Report struct {
+	StartAt time.Time    `json:"start_at"`
+	EndAt   time.Time    `json:"end_at"`
+	Summary Summary      `json:"summary"`
+	Hosts   []HostStat   `json:"hosts"`
+	Tasks   []TaskReport `json:"tasks"`
+	Limit   *LimitHit    `json:"limit,omitempty"` // 运行期间触发的限制，没有触发时为nil
+}
+
+// Summary 汇总统计
+type Summary struct {
+	Total        int     `json:"total"`
+	Success      int     `json:"success"`
+	Fail         int     `json:"fail"`
+	Skipped      int     `json:"skipped"`
+	Pending      int     `json:"pending"` // 因停止而未完成的任务
+	Deduplicated int     `json:"deduplicated"`
+	Unchanged    int     `json:"unchanged"` // 条件请求返回304的任务数
+	Bytes        int64   `json:"bytes"`     // 本次运行接收的字节数
+	Size         float64 `json:"size"`      // 成功和跳过的任务的文件大小之和
+	Seconds      float64 `json:"seconds"`
+	TaskRate     float64 `json:"task_rate"`  // 平均每秒成功的任务数
+	Throughput   float64 `json:"throughput"` // 平均下载速度(字节/秒)
+	LatencyP50   float64 `json:"latency_p50_ms"`
+	LatencyP90   float64 `json:"latency_p90_ms"`
+	LatencyP99   float64 `json:"latency_p99_ms"`
+	LatencyMax   float64 `json:"latency_max_ms"`
+}
+
+// TaskReport 单个任务的结果
+type TaskReport struct {
+	ID         int       `json:"id"`
+	Url        string    `json:"url"`
+	File       string    `json:"file"`
+	State      TaskState `json:"state"`
+	Size       float64   `json:"size"`
+	Mime       string    `json:"mime,omitempty"`
+	Type       string    `json:"type,omitempty"`
+	Ext        string    `json:"ext,omitempty"`
+	Duration   float64   `json:"duration_ms"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Attempts   int       `json:"attempts"`
+	Unchanged  bool      `json:"unchanged,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ErrorKind  ErrorKind `json:"error_kind,omitempty"`
+	Retryable  bool      `json:"retryable,omitempty"`
+}
+
+// Report 生成本次运行的报告，应在Wait之后调用
+func (d *Downloader) Report() *Report {
+	snap := d.stats.snapshot()
+	r := &Report{StartAt: d.StartAt, EndAt: d.EndAt, Hosts: d.HostStats(), Limit: d.Limit()}
+	seconds := d.EndAt.Sub(d.StartAt).Seconds()
+	r.Summary = Summary{
+		Total:        snap.Total,
+		Success:      snap.Success,
+		Fail:         snap.Fail,
+		Skipped:      snap.Skipped,
+		Pending:      snap.Pending + snap.Processing,
+		Deduplicated: snap.Deduplicated,
+		Unchanged:    snap.Unchanged,
+		Bytes:        snap.Bytes,
+		Size:         snap.Size,
+		Seconds:      seconds,
+	}
+	if seconds > 0 {
+		r.Summary.TaskRate = float64(snap.Success) / seconds
+		r.Summary.Throughput = float64(snap.Bytes) / seconds
+	}
+
+	d.mu.Lock()
+	tasks := d.Tasks
+	d.mu.Unlock()
+	var latencies []float64
+	for _, task := range tasks {
+		t := TaskReport{
+			ID:        task.ID,
+			Url:       task.Url,
+			File:      task.File.Name,
+			State:     task.State,
+			Size:      task.Size,
+			Mime:      task.Mime,
+			Type:      task.Type,
+			Ext:       task.Ext,
+			Attempts:  task.Attempts,
+			Unchanged: task.Unchanged,
+		}
+		if !task.Start.IsZero() && !task.End.IsZero() {
+			t.Duration = float64(task.End.Sub(task.Start)) / float64(time.Millisecond)
+		}
+		if task.Response != nil {
+			t.StatusCode = task.Response.StatusCode
+		}
+		if task.Error != nil {
+			t.Error = task.Error.Error()
+			t.ErrorKind = ErrorKindOf(task.Error)
+			var derr *DownloadError
+			t.Retryable = errors.As(task.Error, &derr) && derr.Retryable
+		}
+		if task.State == StateDone {
+			latencies = append(latencies, t.Duration)
+		}
+		r.Tasks = append(r.Tasks, t)
+	}
+	sort.Float64s(latencies)
+	r.Summary.LatencyP50 = percentile(latencies, 50)
+	r.Summary.LatencyP90 = percentile(latencies, 90)
+	r.Summary.LatencyP99 = percentile(latencies, 99)
+	r.Summary.LatencyMax = percentile(latencies, 100)
+	return r
+}
+
+// percentile 按最近秩法计算已排序数据的百分位数
+func percentile(sorted []float64, p int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// WriteJSON 以JSON格式输出完整报告
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV 以CSV格式输出每个任务的结果
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "url", "file", "state", "size", "mime", "type", "ext", "duration_ms", "status_code", "attempts", "unchanged", "error_kind", "retryable", "error"})
+	for _, t := range r.Tasks {
+		cw.Write([]string{
+			strconv.Itoa(t.ID),
+			t.Url,
+			t.File,
+			string(t.State),
+			strconv.FormatFloat(t.Size, 'f', -1, 64),
+			t.Mime,
+			t.Type,
+			t.Ext,
+			strconv.FormatFloat(t.Duration, 'f', 3, 64),
+			strconv.Itoa(t.StatusCode),
+			strconv.Itoa(t.Attempts),
+			strconv.FormatBool(t.Unchanged),
+			string(t.ErrorKind),
+			strconv.FormatBool(t.Retryable),
+			t.Error,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// markdownHeader 统计表的表头
+const markdownHeader = "| 任务总数 | 成功数量 | 失败数量 | 总耗时 | 平均每秒完成任务数 | 下载速度 |\n| ------ | ------ | ------ | ------ | ------ | ------ |\n"
+
+// WriteMarkdownRow 以统计表的一行输出汇总，下载速度单位为M/s
+func (r *Report) WriteMarkdownRow(w io.Writer) error {
+	s := r.Summary
+	_, err := fmt.Fprintf(w, "| %d | %d | %d | %s | %f | %f\n", s.Total, s.Success, s.Fail,
+		r.EndAt.Sub(r.StartAt), s.TaskRate, s.Throughput/(1<<20))
+	return err
+}
+
+// appendMarkdown 追加一行到统计表，文件不存在时先写入表头
+func (r *Report) appendMarkdown(path string) error {
+	_, statErr := os.Stat(path)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if os.IsNotExist(statErr) {
+		if _, err := file.WriteString(markdownHeader); err != nil {
+			return err
+		}
+	}
+	return r.WriteMarkdownRow(file)
+}
+
+// Save 按扩展名保存报告：.json为完整报告，.csv为任务列表，.md追加一行到统计表
+func (r *Report) Save(path string) error {
+	var write func(io.Writer) error
+	switch filepath.Ext(path) {
+	case ".md":
+		return r.appendMarkdown(path)
+	case ".json":
+		write = r.WriteJSON
+	case ".csv":
+		write = r.WriteCSV
+	default:
+		// 先检查格式再创建文件，不支持的格式不会清空已有的文件
+		return fmt.Errorf("不支持的报告格式:%s", path)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(file)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
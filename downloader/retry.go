@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy 重试策略，退避时间按指数增长并加入随机抖动
+type RetryPolicy struct {
+	MaxAttempts int           // 最大尝试次数，包含第一次请求
+	BaseDelay   time.Duration // 第一次重试前的退避时间
+	MaxDelay    time.Duration // 退避时间上限
+	// Retryable 判断失败是否可以重试，为nil时使用DefaultRetryable
+	Retryable func(resp *http.Response, err error) bool
+}
+
+// DefaultRetryPolicy 默认重试策略：最多尝试3次，退避时间从500ms开始
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+	}
+}
+
+// DefaultRetryable 网络错误、5xx和429可以重试，其他状态码(如404)和校验失败不重试
+func DefaultRetryable(resp *http.Response, err error) bool {
+	var verifyErr *VerifyError
+	if errors.Is(err, context.Canceled) || errors.As(err, &verifyErr) {
+		return false
+	}
+	if resp != nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	}
+	return err != nil
+}
+
+// ShouldRetry 判断本次失败是否需要重试
+func (p *RetryPolicy) ShouldRetry(resp *http.Response, err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(resp, err)
+	}
+	return DefaultRetryable(resp, err)
+}
+
+// Backoff 计算第attempt次失败后的等待时间。
+// 服务端返回Retry-After时优先使用，否则在[0, BaseDelay*2^(attempt-1)]内随机取值。
+func (p *RetryPolicy) Backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && sec >= 0 {
+			return p.cap(time.Duration(sec) * time.Second)
+		}
+	}
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		// MaxDelay为0时不限制，翻倍到溢出前为止
+		if delay > math.MaxInt64/2 {
+			delay = math.MaxInt64
+			break
+		}
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+	}
+	delay = p.cap(delay)
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+func (p *RetryPolicy) cap(delay time.Duration) time.Duration {
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
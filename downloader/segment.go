@@ -0,0 +1,220 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// segment 分段下载中的一段，每段写入单独的文件以便中断后续传
+type segment struct {
+	index      int
+	start, end int64 // 字节范围，闭区间
+	file       string
+}
+
+// splitSegments 将[0, size)平均分成n段
+func splitSegments(part string, size int64, n int) []segment {
+	if int64(n) > size {
+		n = int(size)
+	}
+	segs := make([]segment, n)
+	step := size / int64(n)
+	for i := range segs {
+		segs[i] = segment{
+			index: i,
+			start: int64(i) * step,
+			end:   int64(i+1)*step - 1,
+			file:  fmt.Sprintf("%s.%d", part, i),
+		}
+	}
+	segs[n-1].end = size - 1
+	return segs
+}
+
+// downloadSegmented 服务端支持Range且文件足够大时分段并发下载。
+// 不满足分段条件时ok为false，由调用方按普通方式下载。
+func (d *Downloader) downloadSegmented(task *DownloadTask) (resp *http.Response, ok bool, err error) {
+	req := task.Request.Clone(task.ctx)
+	req.Method = http.MethodHead
+	resp, err = d.Client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Accept-Ranges"), "bytes") ||
+		resp.ContentLength < d.segmentThreshold || resp.ContentLength <= 0 {
+		return resp, false, nil
+	}
+	task.Response = resp
+	part := d.partPath(task)
+	if err := checkContentType(task, resp); err != nil {
+		return resp, true, discard(part, err)
+	}
+	// 分段文件只有与本次的校验值一致时才能续传，否则服务端文件已经变化
+	task.validator = responseValidator(resp)
+	segs := splitSegments(part, resp.ContentLength, d.segments)
+	if err := resetSegments(part, task.validator, resp.ContentLength, segs); err != nil {
+		return resp, true, err
+	}
+	// 任务本身已经占用了主机的一个连接，其余的段只使用当前空闲的连接，
+	// 不等待其他任务释放连接，避免多个任务各占一个连接后互相等待
+	l := d.limiter(task.Request.URL.Host)
+	workers := 1
+	for workers < len(segs) && l.tryConn() {
+		workers++
+	}
+	defer func() {
+		for i := 1; i < workers; i++ {
+			l.releaseConn()
+		}
+	}()
+	errs := make([]error, len(segs))
+	resps := make([]*http.Response, len(segs))
+	next := make(chan int, len(segs))
+	for i := range segs {
+		next <- i
+	}
+	close(next)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				resps[i], errs[i] = d.fetchSegment(task, segs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	// 失败的段交给任务的重试策略处理，已完成的段在重试时不会再次请求
+	for i, err := range errs {
+		if err != nil {
+			if resps[i] != nil {
+				resp = resps[i]
+			}
+			return resp, true, fmt.Errorf("第%d段: %w", i, err)
+		}
+	}
+	if err := joinSegments(part, segs); err != nil {
+		return resp, true, err
+	}
+	if err := d.commit(task, part); err != nil {
+		return resp, true, err
+	}
+	task.Size = float64(resp.ContentLength)
+	return resp, true, nil
+}
+
+// segmentStateSuffix 记录分段文件是按哪个校验值、大小和段数写入的
+const segmentStateSuffix = ".segments"
+
+// resetSegments 已有的分段文件不是按当前的校验值、大小和段数写入的，或者无法确认时删除它们，
+// 然后记录本次的状态，供中断后续传时比较
+func resetSegments(part, validator string, size int64, segs []segment) error {
+	state := fmt.Sprintf("%d %d %s", size, len(segs), validator)
+	saved, err := os.ReadFile(part + segmentStateSuffix)
+	if err == nil && validator != "" && string(saved) == state {
+		return nil
+	}
+	for _, seg := range segs {
+		if err := os.Remove(seg.file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if validator == "" {
+		// 没有校验值时无法确认续传的数据属于同一个文件，每次都从头下载
+		if err := os.Remove(part + segmentStateSuffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(part+segmentStateSuffix, []byte(state), 0666)
+}
+
+// fetchSegment 下载一段的剩余部分，连接数由downloadSegmented控制，这里只等待主机的速率限制
+func (d *Downloader) fetchSegment(task *DownloadTask, seg segment) (*http.Response, error) {
+	var have int64
+	if info, err := os.Stat(seg.file); err == nil {
+		have = info.Size()
+	}
+	length := seg.end - seg.start + 1
+	if have == length {
+		return nil, nil
+	}
+	if have > length {
+		if err := os.Remove(seg.file); err != nil {
+			return nil, err
+		}
+		have = 0
+	}
+	if err := d.limiter(task.Request.URL.Host).wait(task.ctx); err != nil {
+		return nil, err
+	}
+	req := task.Request.Clone(task.ctx)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", seg.start+have, seg.end))
+	if task.validator != "" {
+		req.Header.Set("If-Range", task.validator)
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+			// 服务端文件已变化或不再支持Range，丢弃这一段
+			os.Remove(seg.file)
+			return resp, errors.New("服务端未按Range返回数据")
+		}
+		return resp, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	if rangeStart(resp) != seg.start+have {
+		return resp, errors.New("Content-Range与请求不一致")
+	}
+	file, err := os.OpenFile(seg.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return resp, err
+	}
+	s, err := io.Copy(file, d.reader(task, resp.Body))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return resp, err
+	}
+	return resp, checkLength(resp, s)
+}
+
+// joinSegments 按顺序拼接各段到.part文件，成功后删除分段文件
+func joinSegments(part string, segs []segment) error {
+	out, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	for _, seg := range segs {
+		in, err := os.Open(seg.file)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		if err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	for _, seg := range segs {
+		os.Remove(seg.file)
+	}
+	os.Remove(part + segmentStateSuffix)
+	return nil
+}
@@ -0,0 +1,113 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultDrainTimeout = 30 * time.Second   // 默认的停止等待时间
+	DefaultSnapshotFile = "unfinished.jsonl" // 默认的未完成任务快照文件
+)
+
+// ErrStopped 下载器停止后未执行的任务的错误
+var ErrStopped = errors.New("下载器已停止")
+
+// shutdown 停止状态
+type shutdown struct {
+	once     sync.Once
+	stopping chan struct{} // 第一次停止时关闭
+}
+
+func newShutdown() *shutdown {
+	return &shutdown{stopping: make(chan struct{})}
+}
+
+// stopped 是否已经开始停止
+func (s *shutdown) stopped() bool {
+	select {
+	case <-s.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// handleSignals 第一次收到信号时停止，第二次收到信号时立即中止正在下载的任务
+func (d *Downloader) handleSignals(sig chan os.Signal) {
+	defer signal.Stop(sig)
+	for {
+		select {
+		case s := <-sig:
+			log.Println("收到信号:", s)
+			d.Stop()
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop 停止下载：不再开始新的任务，正在下载的任务最多等待drainTimeout后中止。
+// 再次调用时立即中止正在下载的任务。结束后未完成的任务会写入快照文件。
+func (d *Downloader) Stop() {
+	if d.shutdown.stopped() {
+		log.Println("立即中止正在下载的任务")
+		d.cancel()
+		return
+	}
+	d.stopGracefully()
+}
+
+// stopGracefully 开始停止，已经在停止时什么也不做，不会像再次调用Stop那样立即中止正在下载的任务
+func (d *Downloader) stopGracefully() {
+	d.shutdown.once.Do(func() {
+		log.Printf("停止下载，最多等待%s完成正在下载的任务\n", d.drainTimeout)
+		close(d.shutdown.stopping)
+		d.queue.close()
+		time.AfterFunc(d.drainTimeout, d.cancel)
+	})
+}
+
+// interrupted 任务是否因停止或中止而未完成
+func interrupted(err error) bool {
+	return errors.Is(err, ErrStopped) || errors.Is(err, context.Canceled)
+}
+
+// writeSnapshot 将未完成的任务写入快照文件，格式与任务日志相同，
+// 之后可以通过WithJournal(快照文件)和LoadJournal恢复这些任务
+func (d *Downloader) writeSnapshot() error {
+	if d.snapshotFile == "" {
+		return nil
+	}
+	d.mu.Lock()
+	tasks := d.Tasks
+	d.mu.Unlock()
+	tmp := d.snapshotFile + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(file)
+	count := 0
+	for _, task := range tasks {
+		if task.State.completed() {
+			continue
+		}
+		if err := enc.Encode(journalEntry(task)); err != nil {
+			file.Close()
+			return err
+		}
+		count++
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	log.Printf("%d个未完成的任务已写入%s\n", count, d.snapshotFile)
+	return os.Rename(tmp, d.snapshotFile)
+}
@@ -0,0 +1,145 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// SkipPolicy 目标文件已存在时的跳过策略
+type SkipPolicy int
+
+const (
+	SkipNever             SkipPolicy = iota // 总是重新下载
+	SkipIfExists                            // 文件存在时跳过
+	SkipIfSizeMatches                       // 文件大小与服务端Content-Length一致时跳过
+	SkipIfChecksumMatches                   // 文件与任务的期望校验值一致时跳过
+)
+
+// shouldSkip 按跳过策略判断任务是否不需要下载
+func (d *Downloader) shouldSkip(task *DownloadTask) bool {
+	if d.skip == SkipNever {
+		return false
+	}
+	size, err := d.storage.Stat(task.File.Name)
+	if err != nil {
+		return false
+	}
+	switch d.skip {
+	case SkipIfExists:
+	case SkipIfSizeMatches:
+		remote, err := d.remoteSize(task)
+		if err != nil || remote != size {
+			return false
+		}
+	case SkipIfChecksumMatches:
+		// 只能读取本地存储中的文件
+		path, ok := d.localPath(task)
+		if !ok || task.Checksum == "" || verifyChecksum(task, path) != nil {
+			return false
+		}
+	default:
+		return false
+	}
+	task.Size = float64(size)
+	return true
+}
+
+// remoteSize 通过HEAD请求获取服务端文件大小
+func (d *Downloader) remoteSize(task *DownloadTask) (int64, error) {
+	l := d.limiter(task.Request.URL.Host)
+	if err := l.acquire(d.ctx); err != nil {
+		return 0, err
+	}
+	req := task.Request.Clone(d.ctx)
+	req.Method = http.MethodHead
+	resp, err := d.Client.Do(req)
+	l.release(0, err)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1, nil
+	}
+	return resp.ContentLength, nil
+}
+
+// dedupStore 内容寻址存储，相同内容的文件通过硬链接共享同一份数据
+type dedupStore struct {
+	dir string
+}
+
+// link 将文件登记到存储中：内容已存在时用硬链接替换文件，返回是否去重
+func (s *dedupStore) link(file string) (bool, error) {
+	sum, err := sha256File(file)
+	if err != nil {
+		return false, err
+	}
+	object := filepath.Join(s.dir, sum[:2], sum)
+	if _, err := os.Stat(object); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(object), 0755); err != nil {
+			return false, err
+		}
+		return false, os.Link(file, object)
+	}
+	if same, err := sameFile(file, object); err != nil || same {
+		return false, err
+	}
+	// 先链接到临时文件再替换，失败时保留原文件
+	tmp := file + ".link"
+	if err := os.Link(object, tmp); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	return true, nil
+}
+
+// dedup 下载成功后将文件登记到内容寻址存储，只支持本地存储
+func (d *Downloader) dedup(task *DownloadTask) {
+	path, ok := d.localPath(task)
+	if d.store == nil || !ok {
+		return
+	}
+	deduplicated, err := d.store.link(path)
+	if err != nil {
+		log.Printf("任务%d去重失败:%v\n", task.ID, err)
+		return
+	}
+	if deduplicated {
+		task.Deduplicated = true
+		d.stats.deduplicated()
+	}
+}
+
+func sha256File(name string) (string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sameFile(a, b string) (bool, error) {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(ia, ib), nil
+}
@@ -0,0 +1,103 @@
+package downloader
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen http.DetectContentType最多使用的字节数
+const sniffLen = 512
+
+// extensions 常见类型的首选扩展名，其余类型使用mime包的结果
+var extensions = map[string]string{
+	"image/jpeg":       ".jpg",
+	"image/png":        ".png",
+	"image/gif":        ".gif",
+	"image/webp":       ".webp",
+	"image/bmp":        ".bmp",
+	"image/avif":       ".avif",
+	"video/mp4":        ".mp4",
+	"video/webm":       ".webm",
+	"audio/mpeg":       ".mp3",
+	"application/pdf":  ".pdf",
+	"application/zip":  ".zip",
+	"application/json": ".json",
+	"text/html":        ".html",
+	"text/plain":       ".txt",
+}
+
+// detectType 根据文件开头的内容和响应的Content-Type判断文件类型。
+// 内容能识别出具体类型时以内容为准，否则使用响应头。
+func detectType(head []byte, header string) string {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	declared, _, _ := mime.ParseMediaType(header)
+	if sniffed != "application/octet-stream" && sniffed != "text/plain" {
+		return sniffed
+	}
+	if declared != "" {
+		return declared
+	}
+	return sniffed
+}
+
+// extension 返回类型对应的扩展名，未知类型返回空字符串
+func extension(mediaType string) string {
+	if ext, ok := extensions[mediaType]; ok {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// matchesType 文件名的扩展名是否与类型一致，如.jpeg与image/jpeg
+func matchesType(name, mediaType string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return false
+	}
+	if extensions[mediaType] == ext {
+		return true
+	}
+	t, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+	return t == mediaType
+}
+
+// sniff 识别下载完成的文件类型，填充File的Mime、Type和Ext。
+// 开启扩展名修正时，扩展名与实际类型不一致的文件会改为正确的扩展名保存。
+func (d *Downloader) sniff(task *DownloadTask, part string) error {
+	file, err := os.Open(part)
+	if err != nil {
+		return err
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	file.Close()
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	var header string
+	if task.Response != nil {
+		header = task.Response.Header.Get("Content-Type")
+	}
+	task.Mime = detectType(head[:n], header)
+	task.Type = strings.SplitN(task.Mime, "/", 2)[0]
+	task.Ext = extension(task.Mime)
+	if d.fixExtension && task.Ext != "" && task.Mime != "application/octet-stream" && !matchesType(task.Name, task.Mime) {
+		task.Name = strings.TrimSuffix(task.Name, filepath.Ext(task.Name)) + task.Ext
+	}
+	return nil
+}
+
+// requested 返回添加任务时指定的文件名，修正扩展名后File.Name可能与之不同
+func (t *DownloadTask) requested() string {
+	if t.name != "" {
+		return t.name
+	}
+	return t.File.Name
+}
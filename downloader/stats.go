@@ -0,0 +1,208 @@
+package downloader
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultProgressInterval 默认的进度快照间隔
+const DefaultProgressInterval = time.Second
+
+// Snapshot 某一时刻的下载统计快照
+type Snapshot struct {
+	Time         time.Time
+	Total        int           // 任务总数
+	Success      int           // 成功数量
+	Fail         int           // 失败数量
+	Processing   int           // 处理中数量
+	Pending      int           // 等待中数量
+	Finished     int           // 结束的数量
+	Skipped      int           // 因文件已存在跳过的数量
+	Deduplicated int           // 内容重复、以硬链接保存的数量
+	Unchanged    int           // 条件请求返回304、文件没有变化的数量
+	Bytes        int64         // 本次运行接收的字节数
+	Size         float64       // 成功和跳过的任务的文件大小之和
+	Elapsed      time.Duration // 已运行时间
+	Rate         float64       // 最近一个间隔内的下载速度(字节/秒)
+	TaskRate     float64       // 平均每秒完成任务数
+	ETA          time.Duration // 按平均完成速度估算的剩余时间，无法估算时为0
+	Paused       bool          // 是否处于暂停状态
+}
+
+// stats 并发安全的下载统计
+type stats struct {
+	bytes        int64 // 原子操作
+	deduplicates int64 // 原子操作
+	unchanges    int64 // 原子操作
+
+	mu     sync.Mutex
+	states map[TaskState]int
+	size   float64
+	start  time.Time
+	paused bool
+	last   Snapshot // 上一次发布的快照，用于计算瞬时速度
+	subs   []chan Snapshot
+}
+
+func newStats() *stats {
+	return &stats{states: map[TaskState]int{}}
+}
+
+// begin 开始计时
+func (s *stats) begin(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start = now
+}
+
+// add 新增一个任务
+func (s *stats) add(task *DownloadTask) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[task.State]++
+	if task.State.completed() {
+		s.size += task.Size
+	}
+}
+
+// transition 任务状态变化
+func (s *stats) transition(task *DownloadTask, from, to TaskState) {
+	if from == to {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[from]--
+	s.states[to]++
+	if to.completed() {
+		s.size += task.Size
+	}
+}
+
+// setPaused 记录暂停状态
+func (s *stats) setPaused(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = paused
+}
+
+// unchanged 记录一次文件未变化
+func (s *stats) unchanged() {
+	atomic.AddInt64(&s.unchanges, 1)
+}
+
+// received 记录接收到的字节数，返回接收的总字节数
+func (s *stats) received(n int64) int64 {
+	return atomic.AddInt64(&s.bytes, n)
+}
+
+// deduplicated 记录一次去重
+func (s *stats) deduplicated() {
+	atomic.AddInt64(&s.deduplicates, 1)
+}
+
+// snapshot 生成当前统计快照
+func (s *stats) snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotLocked(time.Now())
+}
+
+func (s *stats) snapshotLocked(now time.Time) Snapshot {
+	snap := Snapshot{
+		Time:         now,
+		Success:      s.states[StateDone],
+		Fail:         s.states[StateFailed],
+		Processing:   s.states[StateRunning],
+		Pending:      s.states[StatePending],
+		Skipped:      s.states[StateSkipped],
+		Bytes:        atomic.LoadInt64(&s.bytes),
+		Size:         s.size,
+		Deduplicated: int(atomic.LoadInt64(&s.deduplicates)),
+		Unchanged:    int(atomic.LoadInt64(&s.unchanges)),
+		Paused:       s.paused,
+	}
+	snap.Finished = snap.Success + snap.Fail + snap.Skipped
+	snap.Total = snap.Finished + snap.Processing + snap.Pending
+	if s.start.IsZero() {
+		return snap
+	}
+	snap.Elapsed = now.Sub(s.start)
+	if sec := snap.Elapsed.Seconds(); sec > 0 {
+		snap.TaskRate = float64(snap.Finished) / sec
+	}
+	if !s.last.Time.IsZero() {
+		if dt := now.Sub(s.last.Time).Seconds(); dt > 0 {
+			snap.Rate = float64(snap.Bytes-s.last.Bytes) / dt
+		}
+	} else if sec := snap.Elapsed.Seconds(); sec > 0 {
+		snap.Rate = float64(snap.Bytes) / sec
+	}
+	if snap.TaskRate > 0 {
+		remaining := snap.Total - snap.Finished
+		snap.ETA = time.Duration(float64(remaining) / snap.TaskRate * float64(time.Second))
+	}
+	return snap
+}
+
+// subscribe 订阅进度快照，通道只保留最新的一个快照
+func (s *stats) subscribe() <-chan Snapshot {
+	ch := make(chan Snapshot, 1)
+	s.mu.Lock()
+	s.subs = append(s.subs, ch)
+	s.mu.Unlock()
+	return ch
+}
+
+// publish 向所有订阅者发送快照，订阅者来不及接收时丢弃旧快照
+func (s *stats) publish() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := s.snapshotLocked(time.Now())
+	s.last = snap
+	for _, ch := range s.subs {
+		select {
+		case ch <- snap:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- snap
+		}
+	}
+	return snap
+}
+
+// run 定时发布快照，stop关闭后发布最后一个快照并关闭所有订阅通道
+func (s *stats) run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.publish()
+		case <-stop:
+			s.publish()
+			s.mu.Lock()
+			for _, ch := range s.subs {
+				close(ch)
+			}
+			s.subs = nil
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// Snapshot 获取当前的下载统计
+func (d *Downloader) Snapshot() Snapshot {
+	return d.stats.snapshot()
+}
+
+// Subscribe 订阅进度快照，运行期间按进度间隔发送，运行结束后发送最终快照并关闭通道。
+// 需在Run之前调用。
+func (d *Downloader) Subscribe() <-chan Snapshot {
+	return d.stats.subscribe()
+}
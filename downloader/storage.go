@@ -0,0 +1,81 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Storage 下载文件的存储后端。
+// 下载过程中数据先写入本地的.part文件，下载和校验完成后再交给Storage保存。
+type Storage interface {
+	// Commit 将下载完成的本地文件local保存为name，成功后local不再需要
+	Commit(local, name string) error
+	// Stat 返回已保存的name的大小，不存在时返回的错误满足os.IsNotExist
+	Stat(name string) (int64, error)
+	// Close 写入缓冲的数据并释放资源，下载器结束时调用
+	Close() error
+}
+
+// localPather 由保存在本地文件系统中的Storage实现，返回name对应的本地路径。
+// 实现了此接口的存储直接在目标目录中断点续传，并支持按校验值跳过和硬链接去重。
+type localPather interface {
+	Path(name string) string
+}
+
+// LocalStorage 保存到本地目录，Root为空时name即为文件路径
+type LocalStorage struct {
+	Root string
+}
+
+// Path 返回name对应的本地路径
+func (s LocalStorage) Path(name string) string {
+	if s.Root == "" {
+		return name
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(name))
+}
+
+// Commit 将local重命名为目标文件
+func (s LocalStorage) Commit(local, name string) error {
+	path := s.Path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.Rename(local, path)
+}
+
+// Stat 返回文件大小
+func (s LocalStorage) Stat(name string) (int64, error) {
+	info, err := os.Stat(s.Path(name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Close 本地存储不需要释放资源
+func (s LocalStorage) Close() error {
+	return nil
+}
+
+// localPath 返回任务在本地文件系统中的目标路径，存储不在本地时ok为false
+func (d *Downloader) localPath(task *DownloadTask) (path string, ok bool) {
+	if p, ok := d.storage.(localPather); ok {
+		return p.Path(task.File.Name), true
+	}
+	return "", false
+}
+
+// partPath 返回任务的.part文件路径：本地存储放在目标文件旁边，其他存储放在暂存目录中
+func (d *Downloader) partPath(task *DownloadTask) string {
+	if path, ok := d.localPath(task); ok {
+		return path + partSuffix
+	}
+	return filepath.Join(d.stagingDir, filepath.FromSlash(task.File.Name)) + partSuffix
+}
+
+// exists 判断任务的目标文件是否已经保存
+func (d *Downloader) exists(task *DownloadTask) bool {
+	_, err := d.storage.Stat(task.File.Name)
+	return err == nil
+}
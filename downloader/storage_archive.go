@@ -0,0 +1,124 @@
+package downloader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// archiveWriter zip和tar写入器的公共部分
+type archiveWriter interface {
+	add(name string, info os.FileInfo, r io.Reader) error
+	Close() error
+}
+
+// ArchiveStorage 将下载的文件写入一个zip或tar归档，只记录本次运行写入的文件
+type ArchiveStorage struct {
+	mu      sync.Mutex
+	file    *os.File
+	w       archiveWriter
+	entries map[string]int64
+}
+
+// NewZipStorage 创建写入zip归档的存储，已存在的同名归档会被覆盖
+func NewZipStorage(name string) (*ArchiveStorage, error) {
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveStorage{file: file, w: zipWriter{zip.NewWriter(file)}, entries: map[string]int64{}}, nil
+}
+
+// NewTarStorage 创建写入tar归档的存储，已存在的同名归档会被覆盖
+func NewTarStorage(name string) (*ArchiveStorage, error) {
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveStorage{file: file, w: tarWriter{tar.NewWriter(file)}, entries: map[string]int64{}}, nil
+}
+
+// Commit 将local写入归档，条目名为name，写入后删除local
+func (s *ArchiveStorage) Commit(local, name string) error {
+	in, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	name = path.Clean(filepath.ToSlash(name))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.w.add(name, info, in); err != nil {
+		return err
+	}
+	s.entries[name] = info.Size()
+	in.Close()
+	return os.Remove(local)
+}
+
+// Stat 返回本次写入归档的条目大小
+func (s *ArchiveStorage) Stat(name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	size, ok := s.entries[path.Clean(filepath.ToSlash(name))]
+	if !ok {
+		return 0, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return size, nil
+}
+
+// Close 写入归档的目录并关闭文件
+func (s *ArchiveStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.w.Close(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+type zipWriter struct {
+	*zip.Writer
+}
+
+func (w zipWriter) add(name string, info os.FileInfo, r io.Reader) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	// 图片和视频已经压缩过，直接存储
+	header.Method = zip.Store
+	out, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	return err
+}
+
+type tarWriter struct {
+	*tar.Writer
+}
+
+func (w tarWriter) add(name string, info os.FileInfo, r io.Reader) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := w.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
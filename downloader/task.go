@@ -1,5 +1,6 @@
 package downloader
 import (
+	"context"
 	"time"
 	"net/http"
 )
@@ -13,4 +14,33 @@ type DownloadTask struct {
 	Request  *http.Request
 	Response *http.Response
 	Error    error
-}
\ No newline at end of file
+	Attempts int     // 尝试次数
+	Errors   []error // 每次尝试的错误
+	State    TaskState
+	Priority int // 优先级，越大越先下载
+
+	Checksum     string   // 期望的校验值，如"sha256:<hex>"
+	ContentTypes []string // 允许的Content-Type，为空时不检查
+	Deduplicated bool     // 内容与已下载的文件重复，以硬链接保存
+	Received     int64    // 本次运行接收的字节数，下载过程中原子更新
+	Unchanged    bool     // 条件请求返回304，已有文件没有变化
+
+	name      string          // 添加任务时指定的文件名
+	validator string          // 上次响应的ETag或Last-Modified，断点续传时用于If-Range
+	bandwidth *bandwidth      // 任务的带宽限制
+	ctx       context.Context // 当前这次下载使用的context，暂停并中断传输时会被取消
+}
+// setValidator 记录响应的ETag或Last-Modified，用于之后的If-Range
+func (t *DownloadTask) setValidator(resp *http.Response) {
+	if v := responseValidator(resp); v != "" {
+		t.validator = v
+	}
+}
+
+// responseValidator 响应的ETag，没有时为Last-Modified，都没有时为空
+func responseValidator(resp *http.Response) string {
+	if v := resp.Header.Get("ETag"); v != "" {
+		return v
+	}
+	return resp.Header.Get("Last-Modified")
+}
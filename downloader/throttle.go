@@ -0,0 +1,121 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// throttleChunk 限速时每次读取的最大字节数，避免一次读取过多导致速度不均匀
+const throttleChunk = 16 * 1024
+
+// bandwidth 字节级令牌桶，速率可以在运行时调整，rate<=0时不限速
+type bandwidth struct {
+	mu     sync.Mutex
+	rate   float64 // 字节/秒
+	tokens float64 // 可以为负数，表示需要等待偿还的字节数
+	last   time.Time
+}
+
+func newBandwidth(rate float64) *bandwidth {
+	return &bandwidth{rate: rate, last: time.Now()}
+}
+
+// setRate 调整速率
+func (b *bandwidth) setRate(rate float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	b.rate = rate
+	if b.tokens > rate {
+		b.tokens = rate
+	}
+}
+
+// refill 按经过的时间补充令牌，最多积累1秒的量
+func (b *bandwidth) refill(now time.Time) {
+	if b.rate > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+}
+
+// consume 消耗n个字节的令牌，令牌不足时等待
+func (b *bandwidth) consume(ctx context.Context, n int) error {
+	b.mu.Lock()
+	if b.rate <= 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	b.refill(time.Now())
+	b.tokens -= float64(n)
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+	return sleep(ctx, wait)
+}
+
+// limited 是否设置了限速
+func (b *bandwidth) limited() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate > 0
+}
+
+// throttledReader 读取后按全局和任务的带宽限制等待
+type throttledReader struct {
+	ctx    context.Context
+	r      io.Reader
+	limits []*bandwidth
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk && t.limited() {
+		p = p[:throttleChunk]
+	}
+	n, err := t.r.Read(p)
+	for _, b := range t.limits {
+		if werr := b.consume(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (t *throttledReader) limited() bool {
+	for _, b := range t.limits {
+		if b.limited() {
+			return true
+		}
+	}
+	return false
+}
+
+// reader 包装响应体：统计下载字节数，并按带宽限制读取
+func (d *Downloader) reader(task *DownloadTask, body io.Reader) io.Reader {
+	r := io.TeeReader(body, progressWriter{d, task})
+	return &throttledReader{ctx: task.ctx, r: r, limits: []*bandwidth{d.bandwidth, task.bandwidth}}
+}
+
+// SetBandwidthLimit 调整所有任务共享的带宽上限(字节/秒)，<=0表示不限速
+func (d *Downloader) SetBandwidthLimit(bytesPerSec float64) {
+	d.bandwidth.setRate(bytesPerSec)
+}
+
+// SetBandwidthLimit 调整单个任务的带宽上限(字节/秒)，<=0表示不限速
+func (t *DownloadTask) SetBandwidthLimit(bytesPerSec float64) {
+	t.bandwidth.setRate(bytesPerSec)
+}
+
+// WithTaskBandwidth 设置单个任务的带宽上限(字节/秒)
+func WithTaskBandwidth(bytesPerSec float64) TaskOption {
+	return func(task *DownloadTask) {
+		task.bandwidth.setRate(bytesPerSec)
+	}
+}
@@ -0,0 +1,135 @@
+package downloader
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Validators 文件对应的服务端缓存校验信息
+type Validators struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	File         string    `json:"file,omitempty"` // 修正扩展名后实际保存的文件名
+	Time         time.Time `json:"time"`
+}
+
+// validatorIndex 记录每个文件的ETag和Last-Modified的索引文件。
+// 之后再次下载同一个文件时发送条件请求，服务端返回304时不再重新下载。
+type validatorIndex struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]Validators // 文件名 -> 校验信息
+	dirty   bool
+}
+
+func newValidatorIndex(path string) *validatorIndex {
+	return &validatorIndex{path: path, entries: map[string]Validators{}}
+}
+
+// load 读取索引文件，文件不存在时不报错
+func (x *validatorIndex) load() error {
+	data, err := os.ReadFile(x.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return json.Unmarshal(data, &x.entries)
+}
+
+// get 获取文件的校验信息
+func (x *validatorIndex) get(name string) (Validators, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	v, ok := x.entries[name]
+	return v, ok
+}
+
+// update 按响应头更新文件的校验信息，响应没有校验信息时删除旧的记录
+func (x *validatorIndex) update(name, saved string, resp *http.Response) {
+	v := Validators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Time:         time.Now(),
+	}
+	if saved != name {
+		v.File = saved
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if v.ETag == "" && v.LastModified == "" {
+		if _, ok := x.entries[name]; ok {
+			delete(x.entries, name)
+			x.dirty = true
+		}
+		return
+	}
+	x.entries[name] = v
+	x.dirty = true
+}
+
+// save 有变化时写入索引文件
+func (x *validatorIndex) save() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(x.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := x.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, x.path); err != nil {
+		return err
+	}
+	x.dirty = false
+	return nil
+}
+
+// conditional 目标文件已存在且记录了校验信息时，返回用于条件请求的校验信息和已有文件的大小
+func (d *Downloader) conditional(task *DownloadTask) (Validators, int64, bool) {
+	if d.validators == nil {
+		return Validators{}, 0, false
+	}
+	v, ok := d.validators.get(task.requested())
+	if !ok {
+		return v, 0, false
+	}
+	name := task.File.Name
+	if v.File != "" {
+		name = v.File
+	}
+	size, err := d.storage.Stat(name)
+	if err != nil {
+		return v, 0, false
+	}
+	return v, size, true
+}
+
+// setConditional 设置条件请求头
+func setConditional(req *http.Request, v Validators) {
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// remember 下载成功后记录文件的校验信息
+func (d *Downloader) remember(task *DownloadTask) {
+	if d.validators == nil || task.Response == nil || task.Unchanged {
+		return
+	}
+	d.validators.update(task.requested(), task.File.Name, task.Response)
+}
@@ -0,0 +1,109 @@
+package downloader
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// VerifyError 下载内容校验失败，文件会被删除且不再重试
+type VerifyError struct {
+	File   string
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("校验失败 %s: %s", e.File, e.Reason)
+}
+
+// discard 校验失败时删除未完成的文件
+func discard(part string, err error) error {
+	os.Remove(part)
+	return err
+}
+
+// TaskOption 任务配置项
+type TaskOption func(task *DownloadTask)
+
+// WithChecksum 设置期望的校验值，格式为"sha256:<hex>"或"md5:<hex>"
+func WithChecksum(sum string) TaskOption {
+	return func(task *DownloadTask) {
+		task.Checksum = sum
+	}
+}
+
+// WithContentTypes 设置允许的Content-Type，以"/"结尾的表示前缀(如"image/")
+func WithContentTypes(types ...string) TaskOption {
+	return func(task *DownloadTask) {
+		task.ContentTypes = types
+	}
+}
+
+// checkContentType 检查响应的Content-Type是否在任务的允许列表中
+func checkContentType(task *DownloadTask, resp *http.Response) error {
+	if len(task.ContentTypes) == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	for _, t := range task.ContentTypes {
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return nil
+		}
+	}
+	return &VerifyError{File: task.File.Name, Reason: fmt.Sprintf("不允许的Content-Type:%q", mediaType)}
+}
+
+// checkLength 检查本次接收的字节数与Content-Length是否一致
+func checkLength(resp *http.Response, received int64) error {
+	if resp.ContentLength >= 0 && received != resp.ContentLength {
+		return fmt.Errorf("数据不完整，Content-Length为%d，实际接收%d: %w", resp.ContentLength, received, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// verifyChecksum 计算文件的校验值并与任务的期望值比较
+func verifyChecksum(task *DownloadTask, path string) error {
+	if task.Checksum == "" {
+		return nil
+	}
+	algo, want, ok := parseChecksum(task.Checksum)
+	var h hash.Hash
+	switch {
+	case !ok:
+	case algo == "sha256":
+		h = sha256.New()
+	case algo == "md5":
+		h = md5.New()
+	}
+	if h == nil {
+		return &VerifyError{File: task.File.Name, Reason: fmt.Sprintf("不支持的校验值:%q", task.Checksum)}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+		return &VerifyError{File: task.File.Name, Reason: fmt.Sprintf("%s不一致，期望%s，实际%s", algo, want, got)}
+	}
+	return nil
+}
+
+// parseChecksum 解析"算法:值"格式的校验值
+func parseChecksum(sum string) (algo, value string, ok bool) {
+	i := strings.Index(sum, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	return strings.ToLower(sum[:i]), sum[i+1:], true
+}
@@ -0,0 +1,231 @@
+// Package gallery 为下载完成的图片目录生成缩略图和预览图(contact sheet)
+package gallery
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config 缩略图和预览图的配置
+type Config struct {
+	ThumbWidth   int         // 缩略图最大宽度
+	ThumbHeight  int         // 缩略图最大高度
+	Columns      int         // 预览图每行的图片数
+	Padding      int         // 预览图中图片的间距
+	Background   color.Color // 预览图背景色
+	Quality      int         // JPEG质量
+	ThumbDir     string      // 缩略图目录，相对于图片目录
+	ContactSheet string      // 预览图文件名，保存在图片目录中
+}
+
+// DefaultConfig 默认配置
+func DefaultConfig() Config {
+	return Config{
+		ThumbWidth:   240,
+		ThumbHeight:  320,
+		Columns:      6,
+		Padding:      8,
+		Background:   color.White,
+		Quality:      85,
+		ThumbDir:     "thumbs",
+		ContactSheet: "contact.jpg",
+	}
+}
+
+// imageExts 可以用标准库解码的图片扩展名
+var imageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// Images 列出目录中的图片，按文件名中的数字排序，不包括预览图
+func (c Config) Images(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || name == c.ContactSheet || !imageExts[strings.ToLower(filepath.Ext(name))] {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Slice(files, func(i, j int) bool { return lessNatural(files[i], files[j]) })
+	return files, nil
+}
+
+// lessNatural 文件名是数字时按数字大小排序，如2.jpg排在10.jpg之前
+func lessNatural(a, b string) bool {
+	na, errA := strconv.Atoi(strings.TrimSuffix(filepath.Base(a), filepath.Ext(a)))
+	nb, errB := strconv.Atoi(strings.TrimSuffix(filepath.Base(b), filepath.Ext(b)))
+	if errA == nil && errB == nil && na != nb {
+		return na < nb
+	}
+	if (errA == nil) != (errB == nil) {
+		return errA == nil
+	}
+	return a < b
+}
+
+// Process 为目录中的每张图片生成缩略图，并生成一张预览图。
+// 无法解码的图片(如WebP)会被跳过并记录到日志。
+func (c Config) Process(dir string) error {
+	files, err := c.Images(dir)
+	if err != nil {
+		return err
+	}
+	thumbDir := filepath.Join(dir, c.ThumbDir)
+	if err := os.MkdirAll(thumbDir, 0755); err != nil {
+		return err
+	}
+	var thumbs []image.Image
+	for _, file := range files {
+		thumb, err := c.Thumbnail(file)
+		if err != nil {
+			log.Println("生成缩略图失败:", file, err)
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)) + ".jpg"
+		if err := c.save(filepath.Join(thumbDir, name), thumb); err != nil {
+			return err
+		}
+		thumbs = append(thumbs, thumb)
+	}
+	if len(thumbs) == 0 {
+		return fmt.Errorf("%s中没有可以解码的图片", dir)
+	}
+	return c.save(filepath.Join(dir, c.ContactSheet), c.Sheet(thumbs))
+}
+
+// Thumbnail 读取图片并缩小到ThumbWidth*ThumbHeight以内，保持宽高比，不放大
+func (c Config) Thumbnail(file string) (image.Image, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	w, h := fit(b.Dx(), b.Dy(), c.ThumbWidth, c.ThumbHeight)
+	return resize(img, w, h), nil
+}
+
+// Sheet 按网格排列缩略图，每张缩略图居中放在ThumbWidth*ThumbHeight的格子中
+func (c Config) Sheet(thumbs []image.Image) image.Image {
+	cols := c.Columns
+	if cols < 1 {
+		cols = 1
+	}
+	if cols > len(thumbs) {
+		cols = len(thumbs)
+	}
+	rows := (len(thumbs) + cols - 1) / cols
+	cellW, cellH := c.ThumbWidth+c.Padding, c.ThumbHeight+c.Padding
+	sheet := image.NewRGBA(image.Rect(0, 0, cols*cellW+c.Padding, rows*cellH+c.Padding))
+	bg := c.Background
+	if bg == nil {
+		bg = color.White
+	}
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	for i, thumb := range thumbs {
+		b := thumb.Bounds()
+		x := c.Padding + i%cols*cellW + (c.ThumbWidth-b.Dx())/2
+		y := c.Padding + i/cols*cellH + (c.ThumbHeight-b.Dy())/2
+		draw.Draw(sheet, image.Rect(x, y, x+b.Dx(), y+b.Dy()), thumb, b.Min, draw.Over)
+	}
+	return sheet
+}
+
+// save 以JPEG格式保存图片
+func (c Config) save(path string, img image.Image) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = jpeg.Encode(file, img, &jpeg.Options{Quality: c.Quality})
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// fit 计算缩放到maxW*maxH以内的尺寸
+func fit(w, h, maxW, maxH int) (int, int) {
+	if w <= 0 || h <= 0 {
+		return 1, 1
+	}
+	if maxW <= 0 || w <= maxW {
+		maxW = w
+	}
+	if maxH <= 0 || h <= maxH {
+		maxH = h
+	}
+	if w*maxH > h*maxW {
+		return maxW, max(1, h*maxW/w)
+	}
+	return max(1, w*maxH/h), maxH
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// resize 按区域平均缩小图片：目标像素取其覆盖的所有源像素的平均值
+func resize(img image.Image, w, h int) image.Image {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				off := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[off])
+					g += uint32(src.Pix[off+1])
+					bl += uint32(src.Pix[off+2])
+					a += uint32(src.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			off := dst.PixOffset(x, y)
+			dst.Pix[off] = uint8(r / n)
+			dst.Pix[off+1] = uint8(g / n)
+			dst.Pix[off+2] = uint8(bl / n)
+			dst.Pix[off+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,162 @@
+package gallery
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// solid 生成单色图片
+func solid(w, h int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestGallery(t *testing.T) {
+	t.Run("test fit", func(t *testing.T) {
+		for _, c := range []struct {
+			w, h, maxW, maxH int
+			wantW, wantH     int
+		}{
+			{480, 640, 240, 320, 240, 320},  // 等比例缩小
+			{1000, 500, 240, 320, 240, 120}, // 宽图按宽度缩小
+			{300, 1200, 240, 320, 80, 320},  // 长图按高度缩小
+			{100, 50, 240, 320, 100, 50},    // 不放大
+			{1000, 1, 240, 320, 240, 1},     // 至少1像素
+			{500, 400, 0, 200, 250, 200},    // 0表示不限制
+			{0, 100, 240, 320, 1, 1},
+		} {
+			w, h := fit(c.w, c.h, c.maxW, c.maxH)
+			if w != c.wantW || h != c.wantH {
+				t.Errorf("fit(%d, %d, %d, %d) = %dx%d，应为%dx%d", c.w, c.h, c.maxW, c.maxH, w, h, c.wantW, c.wantH)
+			}
+		}
+	})
+
+	t.Run("test natural order", func(t *testing.T) {
+		for _, c := range []struct {
+			a, b string
+			less bool
+		}{
+			{"a/2.jpg", "a/10.jpg", true},
+			{"a/10.jpg", "a/2.jpg", false},
+			{"a/2.jpg", "a/2.png", true},
+			{"a/9.jpg", "a/cover.jpg", true},
+			{"a/cover.jpg", "a/9.jpg", false},
+			{"a/b.jpg", "a/c.jpg", true},
+		} {
+			if got := lessNatural(c.a, c.b); got != c.less {
+				t.Errorf("lessNatural(%q, %q) = %v", c.a, c.b, got)
+			}
+		}
+	})
+
+	t.Run("test sheet", func(t *testing.T) {
+		c := Config{ThumbWidth: 20, ThumbHeight: 30, Columns: 3, Padding: 2, Background: color.White}
+		red := color.RGBA{255, 0, 0, 255}
+		thumbs := []image.Image{solid(20, 30, red), solid(10, 30, red), solid(20, 10, red), solid(20, 30, red)}
+		sheet := c.Sheet(thumbs)
+		// 3列2行，每格为缩略图尺寸加间距，外侧再加一圈间距
+		if size := sheet.Bounds().Size(); size != (image.Point{X: 3*22 + 2, Y: 2*32 + 2}) {
+			t.Fatalf("预览图尺寸为%v", size)
+		}
+		isRed := func(x, y int) bool {
+			r, g, _, _ := sheet.At(x, y).RGBA()
+			return r == 0xffff && g == 0
+		}
+		for _, p := range []struct {
+			x, y int
+			red  bool
+		}{
+			{2, 2, true},    // 第1张左上角
+			{1, 1, false},   // 间距
+			{21, 31, true},  // 第1张右下角
+			{28, 10, false}, // 第2张宽10，居中后左侧留白5
+			{29, 10, true},
+			{38, 10, true},
+			{39, 10, false},
+			{50, 11, false}, // 第3张高10，居中后上方留白10
+			{50, 12, true},
+			{50, 21, true},
+			{50, 22, false},
+			{2, 34, true}, // 第4张换行
+			{24, 34, false},
+		} {
+			if got := isRed(p.x, p.y); got != p.red {
+				t.Errorf("(%d, %d)是否为缩略图:%v，应为%v", p.x, p.y, got, p.red)
+			}
+		}
+		if size := c.Sheet(thumbs[:1]).Bounds().Size(); size != (image.Point{X: 24, Y: 34}) {
+			t.Fatalf("图片少于列数时按图片数排列:%v", size)
+		}
+	})
+
+	t.Run("test process", func(t *testing.T) {
+		dir := t.TempDir()
+		for name, size := range map[string]image.Point{"1.png": {800, 600}, "2.png": {100, 200}, "10.png": {300, 900}} {
+			file, err := os.Create(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := png.Encode(file, solid(size.X, size.Y, color.RGBA{0, 128, 255, 255})); err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+		}
+		if err := os.WriteFile(filepath.Join(dir, "3.jpg"), []byte("not an image"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		c := DefaultConfig()
+		if err := c.Process(dir); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]image.Point{"1.jpg": {240, 180}, "2.jpg": {100, 200}, "10.jpg": {106, 320}} {
+			file, err := os.Open(filepath.Join(dir, c.ThumbDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := jpeg.DecodeConfig(file)
+			file.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != want.X || cfg.Height != want.Y {
+				t.Errorf("%s的缩略图尺寸为%dx%d，应为%v", name, cfg.Width, cfg.Height, want)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, c.ThumbDir, "3.jpg")); !os.IsNotExist(err) {
+			t.Fatal("无法解码的图片不应生成缩略图")
+		}
+		file, err := os.Open(filepath.Join(dir, c.ContactSheet))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		cfg, err := jpeg.DecodeConfig(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 3*(c.ThumbWidth+c.Padding) + c.Padding; cfg.Width != want {
+			t.Fatalf("预览图宽度为%d，应为%d", cfg.Width, want)
+		}
+
+		// 预览图不会被当作相册中的图片
+		images, err := c.Images(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(images) != 4 || filepath.Base(images[0]) != "1.png" || filepath.Base(images[3]) != "10.png" {
+			t.Fatalf("图片列表为%v", images)
+		}
+	})
+}
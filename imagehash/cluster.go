@@ -0,0 +1,235 @@
+package imagehash
+
+import (
+	"image"
+	"io/fs"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Entry 一张图片及其感知哈希
+type Entry struct {
+	Path string      `json:"path"`
+	Hash Hash        `json:"hash"`
+	Size int64       `json:"size"`
+	Dim  image.Point `json:"dim"`
+}
+
+// Cluster 一组相似的图片，第一张为建议保留的图片(分辨率最高、文件最大)
+type Cluster []Entry
+
+// imageExts 可以用标准库解码的图片扩展名
+var imageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// Scanner 扫描目录中的图片并计算感知哈希
+type Scanner struct {
+	Algorithm Algorithm
+	Workers   int                                   // 并发计算的数量，<1时为CPU核数
+	Skip      func(path string, d fs.DirEntry) bool // 返回true时跳过该文件或目录
+	OnError   func(path string, err error)          // 无法读取或解码的图片
+}
+
+// Scan 扫描dir下的所有图片
+func (s Scanner) Scan(dir string) ([]Entry, error) {
+	var files []string
+	var sizes []int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if s.Skip != nil && s.Skip(path, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !imageExts[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, path)
+		sizes = append(sizes, info.Size())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	workers := s.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	entries := make([]*Entry, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				h, dim, err := File(files[i], s.Algorithm)
+				if err != nil {
+					if s.OnError != nil {
+						s.OnError(files[i], err)
+					}
+					continue
+				}
+				entries[i] = &Entry{Path: files[i], Hash: h, Size: sizes[i], Dim: dim}
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	result := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		if e != nil {
+			result = append(result, *e)
+		}
+	}
+	return result, nil
+}
+
+// Group 将相似的图片分组，只返回包含多张图片的组。每组的第一张为中心，
+// 组内每张图片与中心的汉明距离都不超过threshold，因此A~B~C这样的链不会把与A相差很远的C归入A的组。
+// 先用BK树和并查集找出相近图片的连通分量，避免两两比较，再在每个分量内围绕中心划分。
+func Group(entries []Entry, threshold int) []Cluster {
+	parent := make([]int, len(entries))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	tree := &bkTree{}
+	for i, e := range entries {
+		tree.search(e.Hash, threshold, func(j int) {
+			if a, b := find(i), find(j); a != b {
+				parent[a] = b
+			}
+		})
+		tree.insert(e.Hash, i)
+	}
+
+	groups := map[int][]Entry{}
+	for i, e := range entries {
+		root := find(i)
+		groups[root] = append(groups[root], e)
+	}
+	var clusters []Cluster
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		sort.Slice(g, func(i, j int) bool { return better(g[i], g[j]) })
+		clusters = append(clusters, split(g, threshold)...)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i][0].Path < clusters[j][0].Path })
+	return clusters
+}
+
+// split 将按better排好序的连通分量划分为若干组：依次取剩余图片中最好的一张为中心，
+// 与中心距离不超过threshold的图片归入该组
+func split(g []Entry, threshold int) []Cluster {
+	var clusters []Cluster
+	for len(g) > 1 {
+		center := g[0]
+		c := Cluster{center}
+		var rest []Entry
+		for _, e := range g[1:] {
+			if Distance(center.Hash, e.Hash) <= threshold {
+				c = append(c, e)
+			} else {
+				rest = append(rest, e)
+			}
+		}
+		if len(c) > 1 {
+			clusters = append(clusters, c)
+		}
+		g = rest
+	}
+	return clusters
+}
+
+// better 保留分辨率更高的图片，其次是文件更大的，最后按路径
+func better(a, b Entry) bool {
+	if pa, pb := a.Dim.X*a.Dim.Y, b.Dim.X*b.Dim.Y; pa != pb {
+		return pa > pb
+	}
+	if a.Size != b.Size {
+		return a.Size > b.Size
+	}
+	return a.Path < b.Path
+}
+
+// bkTree 按汉明距离组织的BK树
+type bkTree struct {
+	root *bkNode
+}
+
+type bkNode struct {
+	hash     Hash
+	ids      []int // 哈希相同的图片
+	children map[int]*bkNode
+}
+
+func (t *bkTree) insert(h Hash, id int) {
+	if t.root == nil {
+		t.root = &bkNode{hash: h, ids: []int{id}}
+		return
+	}
+	n := t.root
+	for {
+		d := Distance(n.hash, h)
+		if d == 0 {
+			n.ids = append(n.ids, id)
+			return
+		}
+		child, ok := n.children[d]
+		if !ok {
+			if n.children == nil {
+				n.children = map[int]*bkNode{}
+			}
+			n.children[d] = &bkNode{hash: h, ids: []int{id}}
+			return
+		}
+		n = child
+	}
+}
+
+// search 对距离h不超过threshold的所有图片调用fn
+func (t *bkTree) search(h Hash, threshold int, fn func(id int)) {
+	if t.root == nil {
+		return
+	}
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d := Distance(n.hash, h)
+		if d <= threshold {
+			for _, id := range n.ids {
+				fn(id)
+			}
+		}
+		for k, child := range n.children {
+			if k >= d-threshold && k <= d+threshold {
+				stack = append(stack, child)
+			}
+		}
+	}
+}
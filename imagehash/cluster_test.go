@@ -0,0 +1,131 @@
+package imagehash
+
+import (
+	"image"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	entry := func(path string, h Hash, width int) Entry {
+		return Entry{Path: path, Hash: h, Dim: image.Point{X: width, Y: width}}
+	}
+	paths := func(clusters []Cluster) [][]string {
+		var out [][]string
+		for _, c := range clusters {
+			var p []string
+			for _, e := range c {
+				p = append(p, e.Path)
+			}
+			out = append(out, p)
+		}
+		return out
+	}
+	for _, c := range []struct {
+		name      string
+		entries   []Entry
+		threshold int
+		want      [][]string
+	}{
+		{
+			name:      "identical",
+			entries:   []Entry{entry("a", 0xabc, 10), entry("b", 0xabc, 20)},
+			threshold: 0,
+			want:      [][]string{{"b", "a"}},
+		},
+		{
+			name:      "distinct",
+			entries:   []Entry{entry("a", 0, 10), entry("b", 0xffff, 10)},
+			threshold: 6,
+			want:      nil,
+		},
+		{
+			// A~B、B~C，但C与A的距离为6，超过阈值，不能随A一起处理
+			name:      "chain",
+			entries:   []Entry{entry("a", 0, 30), entry("b", 0x7, 20), entry("c", 0x3f, 10)},
+			threshold: 4,
+			want:      [][]string{{"a", "b"}},
+		},
+		{
+			// 链上的图片围绕各自的中心分组
+			name: "long chain",
+			entries: []Entry{entry("a", 0, 40), entry("b", 0x7, 30), entry("c", 0x3f, 20),
+				entry("d", 0x1ff, 10)},
+			threshold: 4,
+			want:      [][]string{{"a", "b"}, {"c", "d"}},
+		},
+		{
+			name:      "two groups",
+			entries:   []Entry{entry("a", 0, 10), entry("x", ^Hash(0), 10), entry("b", 1, 20), entry("y", ^Hash(1), 20)},
+			threshold: 2,
+			want:      [][]string{{"b", "a"}, {"y", "x"}},
+		},
+	} {
+		got := paths(Group(c.entries, c.threshold))
+		if len(got) != len(c.want) {
+			t.Errorf("%s: 分组为%v，应为%v", c.name, got, c.want)
+			continue
+		}
+		for i := range got {
+			if len(got[i]) != len(c.want[i]) {
+				t.Errorf("%s: 分组为%v，应为%v", c.name, got, c.want)
+				break
+			}
+			for j := range got[i] {
+				if got[i][j] != c.want[i][j] {
+					t.Errorf("%s: 分组为%v，应为%v", c.name, got, c.want)
+					break
+				}
+			}
+		}
+		for _, cluster := range Group(c.entries, c.threshold) {
+			for _, e := range cluster {
+				if d := Distance(cluster[0].Hash, e.Hash); d > c.threshold {
+					t.Errorf("%s: %s与中心%s的距离%d超过阈值", c.name, e.Path, cluster[0].Path, d)
+				}
+			}
+		}
+	}
+}
+
+func TestBKTree(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	hashes := make([]Hash, 500)
+	for i := range hashes {
+		// 以少量基准哈希为中心随机翻转几位，保证有足够多相近的哈希
+		h := Hash(r.Uint64())
+		if i >= 50 {
+			h = hashes[r.Intn(50)]
+			for n := r.Intn(12); n > 0; n-- {
+				h ^= 1 << uint(r.Intn(64))
+			}
+		}
+		hashes[i] = h
+	}
+	tree := &bkTree{}
+	for i, h := range hashes {
+		tree.insert(h, i)
+	}
+	for _, threshold := range []int{0, 1, 4, 10, 20} {
+		for q := 0; q < 50; q++ {
+			query := hashes[r.Intn(len(hashes))]
+			var got, want []int
+			tree.search(query, threshold, func(id int) { got = append(got, id) })
+			for i, h := range hashes {
+				if Distance(query, h) <= threshold {
+					want = append(want, i)
+				}
+			}
+			sort.Ints(got)
+			if len(got) != len(want) {
+				t.Fatalf("阈值%d: BK树找到%d个，暴力查找%d个", threshold, len(got), len(want))
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("阈值%d: BK树结果%v与暴力查找%v不同", threshold, got, want)
+				}
+			}
+		}
+	}
+}
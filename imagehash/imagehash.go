@@ -0,0 +1,211 @@
+// Package imagehash 计算图片的感知哈希，用于找出重新编码、缩放后内容相同的图片
+package imagehash
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+)
+
+// Algorithm 感知哈希算法
+type Algorithm string
+
+const (
+	AHash Algorithm = "ahash" // 均值哈希：缩小到8x8，像素与平均值比较
+	DHash Algorithm = "dhash" // 差异哈希：缩小到9x8，比较相邻像素
+	PHash Algorithm = "phash" // DCT哈希：缩小到32x32做DCT，低频系数与中位数比较，对重新编码最稳定
+)
+
+// ParseAlgorithm 解析算法名称
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch a := Algorithm(name); a {
+	case AHash, DHash, PHash:
+		return a, nil
+	}
+	return "", fmt.Errorf("不支持的哈希算法:%q", name)
+}
+
+// DefaultThreshold 算法建议的相似距离阈值，pHash的低频系数在中位数附近时容易翻转，阈值略大
+func DefaultThreshold(algo Algorithm) int {
+	if algo == PHash {
+		return 10
+	}
+	return 6
+}
+
+// Hash 64位感知哈希
+type Hash uint64
+
+// Distance 两个哈希的汉明距离，越小越相似
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// MarshalText 以16进制字符串输出
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// Compute 计算图片的感知哈希
+func Compute(img image.Image, algo Algorithm) (Hash, error) {
+	switch algo {
+	case AHash:
+		return averageHash(img), nil
+	case DHash:
+		return differenceHash(img), nil
+	case PHash:
+		return dctHash(img), nil
+	}
+	return 0, fmt.Errorf("不支持的哈希算法:%q", algo)
+}
+
+// File 读取并计算图片文件的感知哈希，同时返回图片尺寸
+func File(path string, algo Algorithm) (Hash, image.Point, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, image.Point{}, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, image.Point{}, err
+	}
+	h, err := Compute(img, algo)
+	return h, img.Bounds().Size(), err
+}
+
+func averageHash(img image.Image) Hash {
+	px := grayscale(img, 8, 8)
+	var sum float64
+	for _, v := range px {
+		sum += v
+	}
+	mean := sum / float64(len(px))
+	var h Hash
+	for i, v := range px {
+		if v > mean {
+			h |= 1 << uint(i)
+		}
+	}
+	return h
+}
+
+func differenceHash(img image.Image) Hash {
+	px := grayscale(img, 9, 8)
+	var h Hash
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if px[y*9+x] < px[y*9+x+1] {
+				h |= 1 << uint(y*8+x)
+			}
+		}
+	}
+	return h
+}
+
+func dctHash(img image.Image) Hash {
+	const n = 32
+	px := grayscale(img, n, n)
+	coeffs := dct2(px, n)
+	// 取左上角8x8的低频系数，去掉直流分量后的中位数作为阈值
+	low := make([]float64, 0, 64)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			low = append(low, coeffs[y*n+x])
+		}
+	}
+	sorted := append([]float64(nil), low[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+	var h Hash
+	for i, v := range low {
+		if v > median {
+			h |= 1 << uint(i)
+		}
+	}
+	return h
+}
+
+// dct2 n*n的二维DCT-II
+func dct2(px []float64, n int) []float64 {
+	cos := make([]float64, n*n)
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			cos[k*n+i] = math.Cos(math.Pi / float64(n) * (float64(i) + 0.5) * float64(k))
+		}
+	}
+	rows := make([]float64, n*n)
+	for y := 0; y < n; y++ {
+		for k := 0; k < n; k++ {
+			var s float64
+			for i := 0; i < n; i++ {
+				s += px[y*n+i] * cos[k*n+i]
+			}
+			rows[y*n+k] = s
+		}
+	}
+	out := make([]float64, n*n)
+	for x := 0; x < n; x++ {
+		for k := 0; k < n; k++ {
+			var s float64
+			for i := 0; i < n; i++ {
+				s += rows[i*n+x] * cos[k*n+i]
+			}
+			out[k*n+x] = s
+		}
+	}
+	return out
+}
+
+// grayscale 将图片按区域平均缩小为w*h的灰度值
+func grayscale(img image.Image, w, h int) []float64 {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	lum := luminance(img)
+	out := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var sum float64
+			for sy := y0; sy < y1 && sy < sh; sy++ {
+				for sx := x0; sx < x1 && sx < sw; sx++ {
+					sum += float64(lum(sx, sy))
+				}
+			}
+			out[y*w+x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+	return out
+}
+
+// luminance 返回按相对坐标读取亮度的函数，JPEG解码出的YCbCr图片直接读取Y分量
+func luminance(img image.Image) func(x, y int) uint8 {
+	min := img.Bounds().Min
+	switch m := img.(type) {
+	case *image.YCbCr:
+		return func(x, y int) uint8 { return m.Y[m.YOffset(min.X+x, min.Y+y)] }
+	case *image.Gray:
+		return func(x, y int) uint8 { return m.Pix[m.PixOffset(min.X+x, min.Y+y)] }
+	}
+	return func(x, y int) uint8 {
+		return color.GrayModel.Convert(img.At(min.X+x, min.Y+y)).(color.Gray).Y
+	}
+}
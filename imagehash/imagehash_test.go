@@ -0,0 +1,113 @@
+package imagehash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// testImage 生成带渐变和色块的图片，flip为true时左右翻转
+func testImage(w, h int, flip bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx := x
+			if flip {
+				sx = w - 1 - x
+			}
+			c := color.RGBA{uint8(sx * 255 / w), uint8(y * 255 / h), 80, 255}
+			if sx > w/4 && sx < w/2 && y > h/3 && y < h*2/3 {
+				c = color.RGBA{240, 240, 240, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// reencode 缩放到w*h(最近邻)后以JPEG重新编码
+func reencode(t *testing.T, img image.Image, w, h int, quality int) image.Image {
+	b := img.Bounds()
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			scaled.Set(x, y, img.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestImagehash(t *testing.T) {
+	t.Run("test distance", func(t *testing.T) {
+		for _, c := range []struct {
+			a, b Hash
+			want int
+		}{
+			{0, 0, 0},
+			{0, 1, 1},
+			{0xff, 0, 8},
+			{0xf0f0, 0x0ff0, 8},
+			{^Hash(0), 0, 64},
+			{0x8000000000000001, 1, 1},
+		} {
+			if got := Distance(c.a, c.b); got != c.want {
+				t.Errorf("Distance(%s, %s) = %d，应为%d", c.a, c.b, got, c.want)
+			}
+			if Distance(c.a, c.b) != Distance(c.b, c.a) {
+				t.Errorf("Distance(%s, %s)不对称", c.a, c.b)
+			}
+		}
+	})
+
+	t.Run("test parse algorithm", func(t *testing.T) {
+		for _, c := range []struct {
+			name string
+			ok   bool
+		}{
+			{"ahash", true}, {"dhash", true}, {"phash", true}, {"md5", false}, {"", false},
+		} {
+			if _, err := ParseAlgorithm(c.name); (err == nil) != c.ok {
+				t.Errorf("ParseAlgorithm(%q)的错误为%v", c.name, err)
+			}
+		}
+	})
+
+	t.Run("test reencoded stability", func(t *testing.T) {
+		original := testImage(400, 300, false)
+		for _, c := range []struct {
+			name    string
+			img     image.Image
+			similar bool
+		}{
+			{"jpeg", reencode(t, original, 400, 300, 75), true},
+			{"scaled", reencode(t, original, 200, 150, 85), true},
+			{"low quality", reencode(t, original, 320, 240, 40), true},
+			{"flipped", testImage(400, 300, true), false},
+		} {
+			for _, algo := range []Algorithm{AHash, DHash, PHash} {
+				a, err := Compute(original, algo)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := Compute(c.img, algo)
+				if err != nil {
+					t.Fatal(err)
+				}
+				d, threshold := Distance(a, b), DefaultThreshold(algo)
+				if similar := d <= threshold; similar != c.similar {
+					t.Errorf("%s %s: 距离%d，阈值%d，相似应为%v", c.name, algo, d, threshold, c.similar)
+				}
+			}
+		}
+	})
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"go-spider/metrics"
 	"go-spider/tujidao"
 	"log"
 	"os"
 )
 
+var metricsAddr = flag.String("metrics", "", "提供Prometheus指标接口/metrics的地址，如:9090，为空时不开启")
+
 func init() {
 	file, err := os.OpenFile("logs.txt",os.O_APPEND|os.O_CREATE|os.O_WRONLY,0666)
 	if err != nil {
@@ -15,5 +20,24 @@ func init() {
 }
 
 func main()  {
-	tujidao.TujidaoSpider()
+	flag.Parse()
+	if *metricsAddr != "" {
+		go func() {
+			if err := metrics.ListenAndServe(*metricsAddr); err != nil {
+				log.Println("指标接口启动失败:", err)
+			}
+		}()
+	}
+	switch flag.Arg(0) {
+	case "":
+		tujidao.TujidaoSpider()
+	case "dedup":
+		if err := dedupCommand(flag.Args()[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Println(errUsage)
+		os.Exit(2)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,316 @@
+// Package metrics 以Prometheus文本格式暴露爬虫和下载器的指标
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets 默认的耗时分桶(秒)
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Registry 指标集合
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// metric 可以按文本格式输出的指标
+type metric interface {
+	write(w io.Writer)
+}
+
+// DefaultRegistry 默认的指标集合，Handler输出其中的指标
+var DefaultRegistry = &Registry{}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Write 按注册顺序输出所有指标
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	metrics := r.metrics
+	r.mu.Unlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// desc 指标的名称、说明和标签名
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, helpEscaper.Replace(d.help), d.name, d.kind)
+}
+
+// 文本格式只支持以下转义，strconv.Quote输出的\x、\u等转义不能被Prometheus解析
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// quote 输出带引号的标签值
+func quote(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+// key 标签值拼接成的键
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("指标%s需要%d个标签值，实际为%d个", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// format 输出标签，extra为附加的标签(如le)
+func (d desc) format(key string, extra ...string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+"="+quote(v))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+quote(extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sortedKeys 按键排序，使输出稳定
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec 按标签区分的计数器
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec 创建计数器并注册到DefaultRegistry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, "counter", labels}, values: map[string]float64{}}
+	DefaultRegistry.register(c)
+	return c
+}
+
+// Add 增加计数，v不能为负数
+func (c *CounterVec) Add(v float64, labels ...string) {
+	if v < 0 {
+		panic("计数器不能减少")
+	}
+	key := c.key(labels)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Inc 计数加1
+func (c *CounterVec) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Value 当前的计数
+func (c *CounterVec) Value(labels ...string) float64 {
+	key := c.key(labels)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w)
+	for _, k := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.format(k), formatFloat(c.values[k]))
+	}
+}
+
+// GaugeVec 按标签区分的可增可减的值
+type GaugeVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewGaugeVec 创建仪表并注册到DefaultRegistry
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{desc: desc{name, help, "gauge", labels}, values: map[string]float64{}}
+	DefaultRegistry.register(g)
+	return g
+}
+
+// Add 增加v，v可以为负数
+func (g *GaugeVec) Add(v float64, labels ...string) {
+	key := g.key(labels)
+	g.mu.Lock()
+	g.values[key] += v
+	g.mu.Unlock()
+}
+
+// Set 设置当前值
+func (g *GaugeVec) Set(v float64, labels ...string) {
+	key := g.key(labels)
+	g.mu.Lock()
+	g.values[key] = v
+	g.mu.Unlock()
+}
+
+// Value 当前值
+func (g *GaugeVec) Value(labels ...string) float64 {
+	key := g.key(labels)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[key]
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.header(w)
+	for _, k := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.format(k), formatFloat(g.values[k]))
+	}
+}
+
+// HistogramVec 按标签区分的直方图
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // 每个分桶的累计数量
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec 创建直方图并注册到DefaultRegistry，buckets为nil时使用DefaultBuckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{desc: desc{name, help, "histogram", labels}, buckets: buckets, values: map[string]*histogram{}}
+	DefaultRegistry.register(h)
+	return h
+}
+
+// Observe 记录一个值
+func (h *HistogramVec) Observe(v float64, labels ...string) {
+	key := h.key(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += v
+}
+
+// Count 已记录的值的数量
+func (h *HistogramVec) Count(labels ...string) uint64 {
+	key := h.key(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hist, ok := h.values[key]; ok {
+		return hist.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		hist := h.values[k]
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.format(k, "le", formatFloat(b)), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.format(k, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.format(k), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.format(k), hist.count)
+	}
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler 输出DefaultRegistry中指标的http.Handler
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		DefaultRegistry.Write(w)
+	})
+}
+
+// ListenAndServe 在addr上提供/metrics接口，阻塞直到服务出错
+func ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	log.Println("指标接口:", "http://"+addr+"/metrics")
+	return http.ListenAndServe(addr, mux)
+}
+
+var (
+	requests = NewCounterVec("spider_http_requests_total",
+		"HTTP请求数，按来源、主机和状态码区分，请求失败时状态码为error", "source", "host", "code")
+	requestDuration = NewHistogramVec("spider_http_request_duration_seconds",
+		"HTTP请求耗时(秒)，按来源和主机区分", nil, "source", "host")
+)
+
+// ObserveRequest 记录一次HTTP请求，source为发起请求的模块，code为0表示请求失败
+func ObserveRequest(source, host string, code int, elapsed time.Duration) {
+	status := "error"
+	if code > 0 {
+		status = strconv.Itoa(code)
+	}
+	requests.Inc(source, host, status)
+	requestDuration.Observe(elapsed.Seconds(), source, host)
+}
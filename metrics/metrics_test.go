@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("test text format", func(t *testing.T) {
+		counter := NewCounterVec("test_requests_total", "请求数\n按主机区分，路径如C:\\tmp", "host", "code")
+		counter.Inc("b.example.com", "200")
+		counter.Add(2.5, "a.example.com", "200")
+		counter.Inc("a\"b\\c\nd\te", "error")
+		counter.Inc("图片.example.com", "404")
+
+		gauge := NewGaugeVec("test_running", "运行中的任务数")
+		gauge.Set(3)
+		gauge.Add(-1)
+
+		histogram := NewHistogramVec("test_duration_seconds", "耗时", []float64{1, 0.1, 0.5}, "host")
+		histogram.Observe(0.05, "a")
+		histogram.Observe(0.3, "a")
+		histogram.Observe(2, "a")
+
+		r := &Registry{}
+		r.register(counter)
+		r.register(gauge)
+		r.register(histogram)
+		var buf bytes.Buffer
+		r.Write(&buf)
+
+		want := `# HELP test_requests_total 请求数\n按主机区分，路径如C:\\tmp
+# TYPE test_requests_total counter
+test_requests_total{host="a\"b\\c\nd	e",code="error"} 1
+test_requests_total{host="a.example.com",code="200"} 2.5
+test_requests_total{host="b.example.com",code="200"} 1
+test_requests_total{host="图片.example.com",code="404"} 1
+# HELP test_running 运行中的任务数
+# TYPE test_running gauge
+test_running 2
+# HELP test_duration_seconds 耗时
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{host="a",le="0.1"} 1
+test_duration_seconds_bucket{host="a",le="0.5"} 2
+test_duration_seconds_bucket{host="a",le="1"} 2
+test_duration_seconds_bucket{host="a",le="+Inf"} 3
+test_duration_seconds_sum{host="a"} 2.35
+test_duration_seconds_count{host="a"} 3
+`
+		if got := buf.String(); got != want {
+			t.Fatalf("输出为:\n%s\n应为:\n%s", got, want)
+		}
+	})
+
+	t.Run("test handler", func(t *testing.T) {
+		ObserveRequest("test", "example.com", 200, 0)
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+			t.Fatalf("Content-Type为%q", ct)
+		}
+		if !strings.Contains(rec.Body.String(), `spider_http_requests_total{source="test",host="example.com",code="200"} 1`) {
+			t.Fatalf("应输出请求计数:\n%s", rec.Body.String())
+		}
+	})
+}
@@ -23,8 +23,12 @@ type Course struct {
 	Collector       *colly.Collector
 	LectureNoteUrls []string
 	Categories      []string
+	validators      *validators
 }
 
+// validatorsFile stores ETag and Last-Modified of downloaded files, in the course dir
+const validatorsFile = ".validators.json"
+
 func (c Course) Mkdir(dir string) {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		err := os.MkdirAll(dir, 0755)
@@ -88,9 +92,10 @@ func is(cat string) func(string) bool {
 
 func NewCourse(name, url string, collector *colly.Collector) Course {
 	return Course{
-		Name:      name,
-		Url:       url,
-		Collector: collector,
+		Name:       name,
+		Url:        url,
+		Collector:  collector,
+		validators: loadValidators(fmt.Sprintf("courses/%s/%s", name, validatorsFile)),
 		Categories: []string{
 			"Lecture Notes",
 			"Quizzes",
@@ -180,10 +185,12 @@ func (c Course) downloadFile(collector *colly.Collector, dir, title, url string)
 	collector.OnXML("//a[@class='download-file']", func(element *colly.XMLElement) {
 		fileUrl := element.Attr("href")
 		ext := path.Ext(fileUrl)
-		name := fmt.Sprintf("%s%s", title, ext)
-		err := download(path.Join(dir, name), element.Request.AbsoluteURL(fileUrl))
+		name := validFileName(fmt.Sprintf("%s%s", title, ext))
+		unchanged, err := download(c.validators, path.Join(dir, name), element.Request.AbsoluteURL(fileUrl))
 		if err != nil {
 			log.Printf("download lecture note err:%s \n", err)
+		} else if unchanged {
+			log.Printf("unchanged:%s \n", name)
 		}
 	})
 	collector.OnRequest(func(request *colly.Request) {
@@ -200,20 +207,9 @@ func (c Course) downloadFile(collector *colly.Collector, dir, title, url string)
 func (c Course) resetFileName() {
 	filepath.WalkDir(c.dir(), func(p string, d fs.DirEntry, err error) error {
 		if !d.IsDir() {
-			name := d.Name()
 			oldName := p
 			base := path.Dir(p)
-			name = strings.ReplaceAll(name, ":", "-")
-			name = strings.ReplaceAll(name, "?", "-")
-			name = strings.ReplaceAll(name, ",", "-")
-			name = strings.ReplaceAll(name, "/", "-")
-			name = strings.ReplaceAll(name, "\\", "-")
-			name = strings.ReplaceAll(name, "<", "-")
-			name = strings.ReplaceAll(name, ">", "-")
-			name = strings.ReplaceAll(name, "|", "-")
-			name = strings.ReplaceAll(name, "\"", "-")
-			name = strings.ReplaceAll(name, "*", "-")
-			newName := path.Join(base, name)
+			newName := path.Join(base, validFileName(d.Name()))
 			err := os.Rename(oldName, newName)
 			if err != nil {
 				log.Println(err)
@@ -223,25 +219,53 @@ func (c Course) resetFileName() {
 	})
 }
 
-func download(name, url string) error {
-	resp, err := http.Get(url)
+// replace invalid characters in filename
+func validFileName(name string) string {
+	for _, c := range []string{":", "?", ",", "/", "\\", "<", ">", "|", "\"", "*"} {
+		name = strings.ReplaceAll(name, c, "-")
+	}
+	return name
+}
+
+// download file, send conditional request if the file was downloaded before.
+// unchanged is true when server responds 304 Not Modified
+func download(index *validators, name, url string) (unchanged bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return err
+		return false, err
+	}
+	conditional := index.conditional(req, name)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		index.notModified()
+		return true, nil
+	}
 	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
-		return errors.New(resp.Status)
+		return false, errors.New(resp.Status)
 	}
-	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	// write to a temp file first, a failed copy must not leave a truncated file behind
+	tmp := name + ".tmp"
+	file, err := os.Create(tmp)
 	if err != nil {
-		return err
+		return false, err
 	}
-	defer file.Close()
 	_, err = io.Copy(file, resp.Body)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
 	if err != nil {
-		return err
+		os.Remove(tmp)
+		return false, err
 	}
-	return nil
+	index.update(name, resp)
+	return false, nil
 }
 
 func main() {
@@ -257,4 +281,8 @@ func main() {
 	course := NewCourse(name, homeUrl, c)
 	course.find(c)
 	course.resetFileName()
+	if err := course.validators.save(); err != nil {
+		log.Println(err)
+	}
+	log.Printf("unchanged files:%d \n", course.validators.unchanged)
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// validator holds ETag and Last-Modified of a file
+type validator struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// validators indexes downloaded files, so unchanged files are skipped with conditional requests
+type validators struct {
+	path      string
+	mu        sync.Mutex
+	entries   map[string]validator // file path -> validator
+	unchanged int64                // files answered with 304, atomic
+}
+
+// loadValidators reads the index file, returns an empty index if it does not exist
+func loadValidators(path string) *validators {
+	v := &validators{path: path, entries: map[string]validator{}}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &v.entries)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("read validators err:%s \n", err)
+	}
+	return v
+}
+
+// conditional sets conditional headers if the file exists and has a validator
+func (v *validators) conditional(req *http.Request, name string) bool {
+	v.mu.Lock()
+	e, ok := v.entries[name]
+	v.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if _, err := os.Stat(name); err != nil {
+		return false
+	}
+	if e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+	return true
+}
+
+// update records the validator of the response
+func (v *validators) update(name string, resp *http.Response) {
+	e := validator{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if e.ETag == "" && e.LastModified == "" {
+		delete(v.entries, name)
+		return
+	}
+	v.entries[name] = e
+}
+
+// notModified counts an unchanged file
+func (v *validators) notModified() {
+	atomic.AddInt64(&v.unchanged, 1)
+}
+
+// save writes the index file
+func (v *validators) save() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	data, err := json.MarshalIndent(v.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, v.path)
+}
@@ -0,0 +1,100 @@
+package tujidao
+
+import (
+	"go-spider/downloader"
+	"go-spider/gallery"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// galleryWorkers 同时处理的相册数，处理时需要解码相册中的每张原图，并发过多会占用大量内存
+const galleryWorkers = 2
+
+// albumGallery 相册缩略图和预览图的配置
+var albumGallery = gallery.DefaultConfig()
+
+// albumPipeline 统计每个相册结束的任务，相册的任务全部成功后生成缩略图和预览图
+type albumPipeline struct {
+	config gallery.Config
+	mu     sync.Mutex
+	albums map[string]*albumProgress // 相册目录 -> 进度
+	sem    chan struct{}             // 限制同时处理的相册数
+	wg     sync.WaitGroup
+}
+
+// albumProgress 相册的下载进度
+type albumProgress struct {
+	remaining  int  // 未结束的任务数
+	failed     bool // 是否有任务失败
+	downloaded bool // 本次运行是否下载了新的图片
+}
+
+// newAlbumPipeline 创建并注册到下载器的任务结束回调
+func newAlbumPipeline(d *downloader.Downloader, config gallery.Config) *albumPipeline {
+	p := &albumPipeline{config: config, albums: map[string]*albumProgress{}, sem: make(chan struct{}, galleryWorkers)}
+	d.OnTaskDone(p.done)
+	return p
+}
+
+// expect 登记相册，需在添加相册的任务之前调用
+func (p *albumPipeline) expect(album *Album) error {
+	dir, err := album.LocalDir()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.albums[dir] = &albumProgress{remaining: album.Count}
+	return nil
+}
+
+// done 任务结束时更新相册进度，相册完成时在后台处理图片
+func (p *albumPipeline) done(task *downloader.DownloadTask) {
+	dir := path.Dir(task.Name)
+	p.mu.Lock()
+	progress, ok := p.albums[dir]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	progress.remaining--
+	switch {
+	case task.State == downloader.StateFailed:
+		progress.failed = true
+	case task.State == downloader.StateDone && task.Attempts > 0 && !task.Unchanged:
+		progress.downloaded = true
+	}
+	finished := progress.remaining == 0
+	if finished {
+		delete(p.albums, dir)
+	}
+	p.mu.Unlock()
+	if !finished {
+		return
+	}
+	if progress.failed {
+		log.Println("相册有下载失败的图片，不生成预览图:", dir)
+		return
+	}
+	// 之前的运行已经生成过预览图且没有新下载的图片时不再重新生成
+	if _, err := os.Stat(filepath.Join(dir, p.config.ContactSheet)); err == nil && !progress.downloaded {
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.sem <- struct{}{}
+		defer func() { <-p.sem }()
+		if err := p.config.Process(dir); err != nil {
+			log.Println("生成相册预览图失败:", dir, err)
+		}
+	}()
+}
+
+// wait 等待正在处理的相册完成
+func (p *albumPipeline) wait() {
+	p.wg.Wait()
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"go-spider/common"
 	"go-spider/downloader"
+	"go-spider/metrics"
 	"log"
 	"net/http"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -19,9 +21,19 @@ const (
 	albumImageBaseUrlFormat = "https://tjg.gzhuibei.com/a/1/%d/%d.jpg"
 	cookie                  = "UM_distinctid=17c693cc8ee4fe-0cee9e41dd4ec6-b7a1b38-144000-17c693cc8ef49b; PHPSESSID=3vioa1ieltdv1t0kje0meduuko; uid=229195; name=asdf0823; leixing=3; CNZZDATA1257039673=314412289-1633858333-%7C1633872601"
 	imagesBaseDir           = "images"
+	journalFile             = "images/journal.jsonl"
+	reportFile              = "images/report.json"
+	failedFile              = "images/failed.jsonl"
+	coverPriority           = 100
 	Hint                    = "选择标签(T/t)选择页码(P/p),下载(D/d{page})"
 )
 
+// imageHostLimit 图片服务器的访问限制，过快会被限流
+var imageHostLimit = downloader.HostLimit{Rate: 20, Burst: 10, MaxConns: 8, Delay: 100 * time.Millisecond}
+
+// imagesDiskGuard 图片目录所在磁盘剩余空间不足1G时暂停，腾出空间后自动继续
+var imagesDiskGuard = downloader.DiskGuard{Path: imagesBaseDir, MinFree: 1 << 30}
+
 type Tag struct {
 	Name  string
 	Url   string
@@ -241,17 +253,41 @@ func TujidaoSpider() {
 		}
 		if isDownload {
 			// 初始化下载器
-			downloader := downloader.NewDownloader()
-			downloadAlbums := tag.listAlbums(client, tag.PagesUrl(downloadPages)...)
-			// 添加任务
-			for _, a := range downloadAlbums {
-				if err := AddAlbumTask(&downloader, &a); err != nil {
-					fmt.Println(err)
-					continue
+			bar := downloader.NewProgressBar(os.Stdout)
+			downloader := downloader.NewDownloader(
+				downloader.WithJournal(journalFile),
+				downloader.WithDefaultHostLimit(imageHostLimit),
+				downloader.WithSkipPolicy(downloader.SkipIfExists),
+				downloader.WithFixExtension(true),
+				downloader.WithFailedFile(failedFile),
+				downloader.WithDiskGuard(imagesDiskGuard),
+				downloader.WithReportFiles(reportFile, "statistic.md"),
+			)
+			// 只恢复记录，未完成的任务随相册重新添加，避免与相册的任务重复
+			if err := downloader.RestoreJournal(); err != nil {
+				fmt.Println("读取下载记录失败:", err)
+			}
+			// 相册下载完成后生成缩略图和预览图
+			pipeline := newAlbumPipeline(downloader, albumGallery)
+			// 边列出相册边下载
+			rendered := bar.Attach(downloader)
+			downloader.Run()
+			for _, url := range tag.PagesUrl(downloadPages) {
+				for _, a := range tag.listAlbums(client, url) {
+					if err := pipeline.expect(&a); err != nil {
+						fmt.Println(err)
+						continue
+					}
+					if err := AddAlbumTask(downloader, &a); err != nil {
+						fmt.Println(err)
+						continue
+					}
 				}
 			}
-			// 下载相册
-			downloader.Start()
+			downloader.Close()
+			downloader.Wait()
+			<-rendered
+			pipeline.wait()
 			downloader.Result()
 			// 回到选择page
 			goto ChoosePage
@@ -260,14 +296,16 @@ func TujidaoSpider() {
 }
 
 // AddAlbumTask 将相册添加到任务中
-func AddAlbumTask(downloader *downloader.Downloader, album *Album) (err error) {
+func AddAlbumTask(d *downloader.Downloader, album *Album) (err error) {
 	dir, err := album.LocalDir()
 	if err != nil {
 		return
 	}
 	for i := 1; i <= album.Count; i++ {
 		img := fmt.Sprintf("%d.jpg", i)
-		err = downloader.AddTask(fmt.Sprintf(albumImageBaseUrlFormat, album.Id, i), path.Join(dir, img))
+		// CDN出错时可能返回状态码为200的HTML页面
+		err = d.AddTask(fmt.Sprintf(albumImageBaseUrlFormat, album.Id, i), path.Join(dir, img),
+			downloader.WithContentTypes("image/"), downloader.WithPriority(imagePriority(album, i)))
 		if err != nil {
 			return
 		}
@@ -275,6 +313,14 @@ func AddAlbumTask(downloader *downloader.Downloader, album *Album) (err error) {
 	return
 }
 
+// imagePriority 封面(第1张)最先下载，其余图片所在相册越小越先下载，便于尽早预览
+func imagePriority(album *Album, index int) int {
+	if index == 1 {
+		return coverPriority
+	}
+	return -album.Count / 10
+}
+
 // 获取tag下相册的页数
 func (t *Tag) getPages(client *http.Client) int {
 	// 第一页
@@ -354,11 +400,14 @@ func requestDocument(client *http.Client, url string, headers map[string]string)
 	if err != nil {
 		log.Fatal(err)
 	}
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		metrics.ObserveRequest("tujidao", req.URL.Host, 0, time.Since(start))
 		log.Fatal(err)
 	}
 	defer resp.Body.Close()
+	metrics.ObserveRequest("tujidao", req.URL.Host, resp.StatusCode, time.Since(start))
 	if resp.StatusCode != http.StatusOK {
 		log.Fatalf("status code error:%d %s", resp.StatusCode, resp.Status)
 	}